@@ -0,0 +1,498 @@
+package megaclient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/t3rm1n4l/go-mega"
+)
+
+const (
+	BISYNC_DIR      = "bisync"
+	CONFLICT_SUFFIX = ".conflict-"
+)
+
+// State of a file or folder as seen at the end of the last two-way sync
+type bisyncEntry struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+// State of a local directory and remote folder pair
+type bisyncState struct {
+	Local  string
+	Remote string
+	Files  map[string]bisyncEntry
+}
+
+// Get the state file location for a local directory and remote folder pair
+func (mc *MegaClient) bisyncStatePath(local, remote string) string {
+	h := sha1.Sum([]byte(local + "\n" + remote))
+	return filepath.Join(mc.cfg.StateDir, BISYNC_DIR, hex.EncodeToString(h[:])+".json")
+}
+
+func loadBisyncState(file, local, remote string) (*bisyncState, error) {
+	state := &bisyncState{
+		Local:  local,
+		Remote: remote,
+		Files:  make(map[string]bisyncEntry),
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, EINVALID_STATE
+	}
+
+	return state, nil
+}
+
+func (s *bisyncState) save(file string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+// Index the paths by their relative path
+func pathIndex(paths []Path) map[string]Path {
+	index := make(map[string]Path)
+	for _, p := range paths {
+		index[p.GetPath()] = p
+	}
+
+	return index
+}
+
+// Get the remote paths under the folder at resource which are not
+// left out by the filter
+func (mc *MegaClient) remoteTree(resource string) ([]Path, error) {
+	var paths []Path
+
+	node, err := lookupNode(resource, mc.mega.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.GetType() == mega.FILE {
+		return nil, ENOT_DIRECTORY
+	}
+
+	children, err := mc.mega.FS.GetChildren(node)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range children {
+		paths = append(paths, getRemotePaths(mc.mega.FS, n, true)...)
+	}
+
+	return mc.filter.apply(paths), nil
+}
+
+// Two-way sync between a local directory and a remote folder
+//
+// A state file records the size, modification time and remote node
+// hash of every file present on both sides after a run, and every
+// folder. Comparing against it tells apart a file created on one side
+// from a file deleted on the other. A file changed on both sides since
+// the last run is a conflict, the local copy is kept on both sides with
+// a conflict suffix and the remote copy takes the original name. A
+// folder deleted on one side is deleted on the other once nothing is
+// left in it.
+func (mc *MegaClient) BiSync(a, b string) error {
+	local, remote := a, b
+	if _, _, err := getLookupParams(a, mc.mega.FS); err == nil {
+		local, remote = b, a
+	}
+
+	if _, _, err := getLookupParams(local, mc.mega.FS); err != EINVALID_PATH {
+		return EINVALID_SYNC
+	}
+	if _, _, err := getLookupParams(remote, mc.mega.FS); err != nil {
+		return EINVALID_SYNC
+	}
+
+	info, err := os.Stat(local)
+	if err != nil || !info.IsDir() {
+		return EINVALID_SRC
+	}
+
+	abs, err := filepath.Abs(local)
+	if err != nil {
+		return err
+	}
+
+	statefile := mc.bisyncStatePath(abs, remote)
+	state, err := loadBisyncState(statefile, abs, remote)
+	if err != nil {
+		return err
+	}
+
+	_, err = lookupNode(remote, mc.mega.FS)
+	if err == mega.ENOENT {
+		err = mc.Mkdir(remote)
+	}
+	if err != nil {
+		return err
+	}
+
+	lpaths, err := getLocalPaths(local, mc.cfg.SkipError, mc.filter)
+	if err != nil {
+		return err
+	}
+
+	// The remote folder doesn't exist yet only in dry run mode
+	rpaths, err := mc.remoteTree(remote)
+	if err != nil && err != mega.ENOENT {
+		return err
+	}
+
+	lindex := pathIndex(lpaths)
+	rindex := pathIndex(rpaths)
+
+	keys := make([]string, 0, len(lindex)+len(rindex))
+	for k := range lindex {
+		keys = append(keys, k)
+	}
+	for k := range rindex {
+		if _, ok := lindex[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	// Folders are sorted before their contents
+	sort.Strings(keys)
+
+	// Paths which are present on both sides after the run, with their
+	// parent folders
+	kept := make(map[string]bool)
+	keep := func(k string) {
+		for k != "./" && !kept[k] {
+			kept[k] = true
+			k = path.Dir(strings.TrimSuffix(k, "/")) + "/"
+		}
+	}
+
+	// Folders deleted on one side since the last run
+	var folders []string
+
+	var uploads, downloads, ldeletes, rdeletes, conflicts int
+	for _, k := range keys {
+		l, lok := lindex[k]
+		r, rok := rindex[k]
+		prev, pok := state.Files[k]
+		x := path.Join(local, k)
+		y := path.Join(remote, k)
+
+		if (lok && l.t == mega.FOLDER) || (rok && r.t == mega.FOLDER) {
+			switch {
+			case lok && rok:
+				keep(k)
+			case pok:
+				// Deleted at the end, unless a new or changed file
+				// in it is kept
+				folders = append(folders, k)
+			case lok:
+				err = mc.Mkdir(y)
+				keep(k)
+			case mc.cfg.DryRun:
+				mc.plan("create dir", "%s", x)
+				keep(k)
+			default:
+				err = os.MkdirAll(x, os.ModePerm)
+				keep(k)
+			}
+
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		lchanged := lok && (!pok || l.size != prev.Size || !l.ts.Equal(prev.ModTime))
+		rchanged := rok && (!pok || r.hash != prev.Hash)
+
+		same := false
+		if lok && rok && !pok && l.size == r.size {
+			same, err = mc.bisyncSameFile(x, y)
+			if err != nil {
+				return err
+			}
+		}
+
+		deleted := false
+		switch {
+		case same:
+			// Same file created on both sides
+		case lok && rok && (!pok || (lchanged && rchanged)):
+			err = mc.bisyncConflict(x, y)
+			conflicts++
+		case lok && rok && lchanged:
+			err = mc.bisyncUpload(x, y, true)
+			uploads++
+		case lok && rok && rchanged:
+			err = mc.bisyncDownload(x, y, true)
+			downloads++
+		case lok && rok:
+			// Unchanged
+		case lok && pok && !lchanged:
+			err = mc.bisyncDeleteLocal(x)
+			deleted = true
+			ldeletes++
+		case lok:
+			err = mc.bisyncUpload(x, y, false)
+			uploads++
+		case rok && pok && !rchanged:
+			err = mc.bisyncDeleteRemote(y)
+			deleted = true
+			rdeletes++
+		case rok:
+			err = mc.bisyncDownload(x, y, false)
+			downloads++
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !deleted {
+			keep(k)
+		}
+	}
+
+	// The deepest folders go first, so their parents are empty then
+	for i := len(folders) - 1; i >= 0; i-- {
+		k := folders[i]
+		if kept[k] {
+			continue
+		}
+
+		if _, ok := lindex[k]; ok {
+			err = mc.bisyncRemoveLocalDir(path.Join(local, k))
+		} else {
+			err = mc.bisyncRemoveRemoteDir(path.Join(remote, k))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if mc.cfg.DryRun {
+		return nil
+	}
+
+	if mc.cfg.Verbose > 0 {
+		log.Printf("Uploaded %d, downloaded %d, deleted %d local and %d remote file(s), %d conflict(s)",
+			uploads, downloads, ldeletes, rdeletes, conflicts)
+	}
+
+	return mc.bisyncSaveState(state, statefile, local, remote)
+}
+
+// Record the files which are present and alike on both sides, and the
+// folders present on both sides
+func (mc *MegaClient) bisyncSaveState(state *bisyncState, statefile, local, remote string) error {
+	lpaths, err := getLocalPaths(local, mc.cfg.SkipError, mc.filter)
+	if err != nil {
+		return err
+	}
+
+	rpaths, err := mc.remoteTree(remote)
+	if err != nil {
+		return err
+	}
+
+	rindex := pathIndex(rpaths)
+	state.Files = make(map[string]bisyncEntry)
+	for _, l := range lpaths {
+		k := l.GetPath()
+		r, ok := rindex[k]
+		if ok && l.t == mega.FOLDER && r.t == mega.FOLDER {
+			state.Files[k] = bisyncEntry{Hash: r.hash}
+			continue
+		}
+		if l.t != mega.FILE || !ok || r.t != mega.FILE || r.size != l.size {
+			continue
+		}
+
+		state.Files[k] = bisyncEntry{
+			Size:    l.size,
+			ModTime: l.ts,
+			Hash:    r.hash,
+		}
+	}
+
+	return state.save(statefile)
+}
+
+// Check whether a local and a remote file of the same size have the
+// same contents
+func (mc *MegaClient) bisyncSameFile(x, y string) (bool, error) {
+	node, err := lookupNode(y, mc.mega.FS)
+	if err != nil {
+		return false, err
+	}
+
+	return mc.mega.CompareFile(node, x)
+}
+
+func (mc *MegaClient) bisyncUpload(x, y string, replace bool) error {
+	if mc.cfg.DryRun {
+		mc.plan("upload", "%s -> %s", x, y)
+		return nil
+	}
+
+	// The folder may have been deleted on this side
+	err := mc.Mkdir(path.Dir(y))
+	if err != nil {
+		return err
+	}
+
+	if replace {
+		node, err := lookupNode(y, mc.mega.FS)
+		if err != nil {
+			return err
+		}
+
+		err = mc.mega.Delete(node, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return mc.Put(x, y)
+}
+
+func (mc *MegaClient) bisyncDownload(x, y string, replace bool) error {
+	if mc.cfg.DryRun {
+		mc.plan("download", "%s -> %s", y, x)
+		return nil
+	}
+
+	if replace {
+		err := os.Remove(x)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The directory may have been deleted on this side
+	err := os.MkdirAll(path.Dir(x), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return mc.Get(y, x)
+}
+
+func (mc *MegaClient) bisyncDeleteLocal(x string) error {
+	if mc.cfg.DryRun {
+		mc.plan("delete", "%s", x)
+		return nil
+	}
+
+	return os.Remove(x)
+}
+
+func (mc *MegaClient) bisyncDeleteRemote(y string) error {
+	if mc.cfg.DryRun {
+		mc.plan("delete", "%s", y)
+		return nil
+	}
+
+	node, err := lookupNode(y, mc.mega.FS)
+	if err != nil {
+		return err
+	}
+
+	return mc.mega.Delete(node, mc.cfg.Force)
+}
+
+// Remove a local directory deleted on the remote side, unless something
+// left out by the filter is still in it
+func (mc *MegaClient) bisyncRemoveLocalDir(x string) error {
+	if mc.cfg.DryRun {
+		mc.plan("delete", "%s", x)
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(x)
+	if err != nil || len(entries) > 0 {
+		return err
+	}
+
+	return os.Remove(x)
+}
+
+// Remove a remote folder deleted on the local side, unless something
+// left out by the filter is still in it
+func (mc *MegaClient) bisyncRemoveRemoteDir(y string) error {
+	if mc.cfg.DryRun {
+		mc.plan("delete", "%s", y)
+		return nil
+	}
+
+	node, err := lookupNode(y, mc.mega.FS)
+	if err != nil {
+		return err
+	}
+
+	children, err := mc.mega.FS.GetChildren(node)
+	if err != nil || len(children) > 0 {
+		return err
+	}
+
+	return mc.mega.Delete(node, mc.cfg.Force)
+}
+
+// Keep the local copy on both sides under a conflict name and take
+// the remote copy for the original name
+func (mc *MegaClient) bisyncConflict(x, y string) error {
+	suffix := CONFLICT_SUFFIX + time.Now().Format("20060102-150405")
+	if mc.cfg.Verbose > 0 {
+		log.Printf("Conflict: %s and %s were both changed, keeping local copy as %s", x, y, path.Base(x)+suffix)
+	}
+
+	if mc.cfg.DryRun {
+		mc.plan("rename", "%s -> %s", x, x+suffix)
+		mc.plan("upload", "%s -> %s", x+suffix, y+suffix)
+		mc.plan("download", "%s -> %s", y, x)
+		return nil
+	}
+
+	err := os.Rename(x, x+suffix)
+	if err != nil {
+		return err
+	}
+
+	err = mc.Put(x+suffix, y+suffix)
+	if err != nil {
+		return err
+	}
+
+	return mc.Get(y, x)
+}
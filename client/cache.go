@@ -0,0 +1,52 @@
+package megaclient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const CACHE_DIR = "cache"
+
+// Get the filesystem cache file of the configured user
+func (mc *MegaClient) cachePath() string {
+	h := sha1.Sum([]byte(mc.cfg.User))
+	return filepath.Join(mc.cfg.StateDir, CACHE_DIR, hex.EncodeToString(h[:]))
+}
+
+// Start from the cached filesystem on login if there is one
+func (mc *MegaClient) loadCache() {
+	data, err := ioutil.ReadFile(mc.cachePath())
+	if err == nil {
+		mc.mega.SetFileSystemCache(data)
+	}
+}
+
+// Cache the filesystem for the next login
+//
+// The cache is encrypted with the master key of the account by go-mega,
+// as it holds the keys of all the nodes.
+func (mc *MegaClient) saveCache() error {
+	data, err := mc.mega.SaveFileSystem()
+	if err != nil {
+		return err
+	}
+
+	file := mc.cachePath()
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so an interrupted write doesn't
+	// leave a broken cache behind
+	tmp := file + PARTIAL_SUFFIX
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
@@ -8,10 +8,12 @@ import (
 	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/t3rm1n4l/go-humanize"
 	"github.com/t3rm1n4l/go-mega"
 )
 
@@ -21,8 +23,49 @@ const (
 )
 
 type MegaClient struct {
-	cfg  *Config
-	mega *mega.Mega
+	cfg      *Config
+	mega     *mega.Mega
+	filter   *filter
+	progress *transferProgress
+	quota    quotaState
+	output   *OutputWriter
+	prompt   PromptFunc
+}
+
+// Storage usage known from the last quota check and the uploads since
+type quotaState struct {
+	mutex  sync.Mutex
+	loaded bool
+	used   uint64
+	total  uint64
+}
+
+// Details of the logged in account
+type Account struct {
+	Handle string `json:"handle"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+}
+
+func (a Account) String() string {
+	return fmt.Sprintf("Email  : %s\nName   : %s\nHandle : %s", a.Email, a.Name, a.Handle)
+}
+
+// Storage usage of the account in bytes
+type Quota struct {
+	Used  uint64 `json:"used"`
+	Free  uint64 `json:"free"`
+	Total uint64 `json:"total"`
+}
+
+func (q Quota) String() string {
+	percent := float64(0)
+	if q.Total > 0 {
+		percent = 100 * float64(q.Used) / float64(q.Total)
+	}
+
+	return fmt.Sprintf("Used  : %s (%.2f %%)\nFree  : %s\nTotal : %s",
+		humanize.Bytes(q.Used), percent, humanize.Bytes(q.Free), humanize.Bytes(q.Total))
 }
 
 type Config struct {
@@ -30,14 +73,29 @@ type Config struct {
 	Retries         int
 	DownloadWorkers int
 	UploadWorkers   int
+	Transfers       int
 	TimeOut         int
 	User            string
 	Password        string
+	PasswordCommand string
 	Recursive       bool
 	Force           bool
 	SkipSameSize    bool
+	Compare         string
+	Include         []string
+	Exclude         []string
+	ExcludeFrom     string
 	SkipError       bool
+	Delete          bool
+	DryRun          bool
+	Resume          bool
+	Cache           bool
+	StateDir        string
 	Verbose         int
+	Profiles        map[string]json.RawMessage
+
+	raw   []byte // Config file, which the profiles are applied over
+	other bool   // Config of another profile than the selected one
 }
 
 type Path struct {
@@ -46,6 +104,8 @@ type Path struct {
 	size   int64
 	t      int
 	ts     time.Time
+	hash   string
+	link   string
 }
 
 func (p *Path) SetPrefix(s string) {
@@ -62,27 +122,150 @@ func (p Path) GetPath() string {
 	return x
 }
 
+// Folder shared with another user
+type Share struct {
+	Path   string `json:"path"`
+	User   string `json:"user"`
+	Access string `json:"access"`
+}
+
+func (s Share) String() string {
+	return fmt.Sprintf("%-*s %s %s", PATH_WIDTH, s.Path, s.User, s.Access)
+}
+
+// Disk usage of a folder including everything below it
+type Usage struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Files   int    `json:"files"`
+	Folders int    `json:"folders"`
+	depth   int
+}
+
+// Format the usage with the size in bytes or in human readable units
+func (u Usage) Format(human bool) string {
+	size := fmt.Sprintf("%d", u.Size)
+	if human {
+		size = humanize.Bytes(uint64(u.Size))
+	}
+
+	return fmt.Sprintf("%-*s %-*d %s", SIZE_WIDTH, size, SIZE_WIDTH, u.Files, u.Path)
+}
+
+func (u Usage) String() string {
+	return u.Format(false)
+}
+
+// Orders of disk usage entries
+const (
+	SORT_PATH = "path"
+	SORT_SIZE = "size"
+)
+
+// Public link of an exported file
+type PublicLink struct {
+	Path string `json:"path"`
+	Url  string `json:"url"`
+	Key  string `json:"key,omitempty"`
+}
+
+// Get the link with or without the decryption key
+func (l PublicLink) Link(includeKey bool) string {
+	if includeKey {
+		return l.Url + "!" + l.Key
+	}
+
+	return l.Url
+}
+
+func (l PublicLink) String() string {
+	return l.Link(true)
+}
+
 func (p Path) String() string {
 	return fmt.Sprintf("%-*s %-*d %s", PATH_WIDTH, p.GetPath(), SIZE_WIDTH, p.size, p.ts.Format(time.RFC3339))
 }
 
 const (
-	ROOT  = "mega"
-	TRASH = "trash"
+	ROOT   = "mega"
+	TRASH  = "trash"
+	INBOX  = "inbox"
+	SHARED = "shared"
+)
+
+// Access levels of shared folders
+const (
+	ACCESS_READ      = "read"
+	ACCESS_READWRITE = "readwrite"
+	ACCESS_FULL      = "full"
+)
+
+var accessLevels = map[string]int{
+	ACCESS_READ:      mega.ACCESS_READ,
+	ACCESS_READWRITE: mega.ACCESS_READWRITE,
+	ACCESS_FULL:      mega.ACCESS_FULL,
+}
+
+// Modes of comparing files to skip copying of unchanged files
+const (
+	COMPARE_SIZE       = "size"
+	COMPARE_SIZE_MTIME = "size+mtime"
+	COMPARE_CHECKSUM   = "checksum"
 )
 
 var (
-	EINVALID_CONFIG = errors.New("Invalid json config")
-	EINVALID_PATH   = errors.New("Invalid mega path")
-	ENOT_FILE       = errors.New("Requested object is not a file")
-	EINVALID_DEST   = errors.New("Invalid destination path")
-	EINVALID_SRC    = errors.New("Invalid source path")
-	EINVALID_SYNC   = errors.New("Invalid sync command parameters")
-	ENOT_DIRECTORY  = errors.New("A non-directory exists at this path")
-	EFILE_EXISTS    = errors.New("File with same name already exists")
-	EDIR_EXISTS     = errors.New("A directory with same name already exists")
+	EINVALID_CONFIG   = errors.New("Invalid json config")
+	EINVALID_PATH     = errors.New("Invalid mega path")
+	ENOT_FILE         = errors.New("Requested object is not a file")
+	EINVALID_DEST     = errors.New("Invalid destination path")
+	EINVALID_SRC      = errors.New("Invalid source path")
+	EINVALID_SYNC     = errors.New("Invalid sync command parameters")
+	ENOT_DIRECTORY    = errors.New("A non-directory exists at this path")
+	EFILE_EXISTS      = errors.New("File with same name already exists")
+	EDIR_EXISTS       = errors.New("A directory with same name already exists")
+	EINVALID_STATE    = errors.New("Invalid sync state file")
+	EINVALID_MODE     = errors.New("Invalid compare mode")
+	EINVALID_FILTER   = errors.New("Invalid filter pattern")
+	EINVALID_ACCESS   = errors.New("Invalid access level")
+	EINVALID_USER     = errors.New("Invalid user email")
+	EQUOTA            = errors.New("Not enough storage quota")
+	EINVALID_SORT     = errors.New("Invalid sort order")
+	EINVALID_OUTPUT   = errors.New("Invalid output format")
+	ESESSION          = errors.New("Invalid session file")
+	ECREDENTIALS      = errors.New("No user or password given")
+	EPASSWORD_COMMAND = errors.New("Password command failed")
+	EINVALID_PROFILE  = errors.New("No such profile")
+	EINVALID_NAME     = errors.New("Invalid file name")
+	ESKIPPED_SRC      = errors.New("Sync source could not be read, nothing deleted")
 )
 
+// Error with details of where it happened, which keeps the error it is
+// about as its cause
+type Error struct {
+	Cause error
+	msg   string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Wrap cause in an error with the message of format
+func wrapError(cause error, format string, v ...interface{}) error {
+	return &Error{Cause: cause, msg: fmt.Sprintf(format, v...)}
+}
+
+// Get the error an error with details is about
+func ErrorCause(err error) error {
+	for {
+		e, ok := err.(*Error)
+		if !ok {
+			return err
+		}
+		err = e.Cause
+	}
+}
+
 func (cfg *Config) Parse(path string) error {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -93,6 +276,7 @@ func (cfg *Config) Parse(path string) error {
 	if err != nil {
 		return EINVALID_CONFIG
 	}
+	cfg.raw = data
 
 	return nil
 }
@@ -105,6 +289,11 @@ func NewMegaClient(conf *Config) (*MegaClient, error) {
 		mega: mega.New(),
 	}
 
+	// The environment holds the credentials of the selected profile only
+	if user := os.Getenv(ENV_USER); user != "" && !conf.other {
+		conf.User = user
+	}
+
 	if conf.BaseUrl != "" {
 		c.mega.SetAPIUrl(conf.BaseUrl)
 	}
@@ -117,34 +306,97 @@ func NewMegaClient(conf *Config) (*MegaClient, error) {
 		err = c.mega.SetDownloadWorkers(conf.DownloadWorkers)
 
 		if err == mega.EWORKER_LIMIT_EXCEEDED {
-			err = errors.New(fmt.Sprintf("%s : %d <= %d", err, conf.DownloadWorkers, mega.MAX_DOWNLOAD_WORKERS))
+			err = wrapError(err, "%s : %d <= %d", err, conf.DownloadWorkers, mega.MAX_DOWNLOAD_WORKERS)
 		}
 	}
 
 	if conf.UploadWorkers != 0 {
 		err = c.mega.SetUploadWorkers(conf.UploadWorkers)
 		if err == mega.EWORKER_LIMIT_EXCEEDED {
-			err = errors.New(fmt.Sprintf("%s : %d <= %d", err, conf.DownloadWorkers, mega.MAX_UPLOAD_WORKERS))
+			err = wrapError(err, "%s : %d <= %d", err, conf.DownloadWorkers, mega.MAX_UPLOAD_WORKERS)
 		}
 	}
 
+	if conf.Transfers < 0 {
+		err = wrapError(EINVALID_CONFIG, "%s : Transfers %d", EINVALID_CONFIG, conf.Transfers)
+	}
+
 	if conf.TimeOut != 0 {
 		c.mega.SetTimeOut(time.Duration(conf.TimeOut) * time.Second)
 	}
 
+	if conf.SkipSameSize && conf.Compare == "" {
+		conf.Compare = COMPARE_SIZE
+	}
+
+	switch conf.Compare {
+	case "", COMPARE_SIZE, COMPARE_SIZE_MTIME, COMPARE_CHECKSUM:
+	default:
+		err = wrapError(EINVALID_MODE, "%s : %s", EINVALID_MODE, conf.Compare)
+	}
+
+	if err == nil {
+		c.filter, err = newFilter(conf.Include, conf.Exclude, conf.ExcludeFrom)
+	}
+
 	return c, err
 }
 
+// Write the dry run actions as records of the output instead of
+// logging them
+func (mc *MegaClient) SetOutput(out *OutputWriter) {
+	mc.output = out
+}
+
+// Log in, resuming the cached session if there is one
+//
+// With the Cache option, the filesystem is loaded from the cache of the
+// last run and only the changes since are fetched.
 func (mc *MegaClient) Login() error {
-	err := mc.mega.Login(mc.cfg.User, mc.cfg.Password)
+	err := mc.user()
+	if err != nil {
+		return err
+	}
+
+	if mc.cfg.Cache {
+		mc.loadCache()
+	}
+
+	err = mc.login()
+	if err == nil && mc.cfg.Cache {
+		if err := mc.saveCache(); err != nil {
+			log.Printf("Unable to save the filesystem cache (%s)", err)
+		}
+	}
+
 	return err
 }
 
+func (mc *MegaClient) login() error {
+	s, err := mc.loadSession()
+	switch {
+	case os.IsNotExist(err):
+		return mc.passwordLogin()
+	case err == nil:
+		err = mc.mega.ResumeSession(s.Sid, s.Key)
+		if err != mega.ESID {
+			return err
+		}
+	}
+
+	// The cached session has expired or can't be read, so replace it
+	return mc.NewSession()
+}
+
 func (mc *MegaClient) List(resource string) (*[]Path, error) {
 	var root *mega.Node
 	var paths []Path
 	var err error
 
+	if index, ok := getSharedIndex(resource, mc.mega.FS); ok {
+		return &index, nil
+	}
+
 	root, pathsplit, err := getLookupParams(resource, mc.mega.FS)
 	if err != nil {
 		return nil, err
@@ -178,12 +430,17 @@ func (mc *MegaClient) List(resource string) (*[]Path, error) {
 			p.SetPrefix(resource)
 			p.t = indexnode.GetType()
 			p.size = indexnode.GetSize()
-			p.ts = indexnode.GetTimeStamp()
+			p.ts = indexnode.GetModTime()
+			p.hash = indexnode.GetHash()
+			p.link = mc.mega.ExportedLink(indexnode, true)
 			paths = append(paths, p)
 		} else {
 			for _, n := range nodes {
-				for _, p := range getRemotePaths(mc.mega.FS, n, mc.cfg.Recursive) {
+				for _, p := range mc.filter.apply(getRemotePaths(mc.mega.FS, n, mc.cfg.Recursive)) {
 					p.SetPrefix(resource)
+					if node := mc.mega.FS.HashLookup(p.hash); node != nil {
+						p.link = mc.mega.ExportedLink(node, true)
+					}
 					paths = append(paths, p)
 				}
 			}
@@ -195,6 +452,48 @@ func (mc *MegaClient) List(resource string) (*[]Path, error) {
 	return nil, err
 }
 
+// Get the names of the entries of a folder for completion of paths,
+// with a / after the names of folders
+func (mc *MegaClient) Names(resource string) ([]string, error) {
+	var names []string
+
+	if !strings.HasSuffix(resource, "/") {
+		resource += "/"
+	}
+
+	if index, ok := getSharedIndex(resource, mc.mega.FS); ok {
+		for _, p := range index {
+			names = append(names, path.Base(p.GetPath())+"/")
+		}
+		return names, nil
+	}
+
+	node, err := lookupNode(resource, mc.mega.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.GetType() == mega.FILE {
+		return nil, ENOT_DIRECTORY
+	}
+
+	children, err := mc.mega.FS.GetChildren(node)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range children {
+		name := n.GetName()
+		if n.GetType() != mega.FILE {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
 func (mc *MegaClient) Delete(resource string) error {
 	root, pathsplit, err := getLookupParams(resource, mc.mega.FS)
 	if err != nil {
@@ -215,6 +514,11 @@ func (mc *MegaClient) Delete(resource string) error {
 	l := len(nodes)
 	node := nodes[l-1]
 
+	if mc.cfg.DryRun {
+		mc.plan("delete", "%s", resource)
+		return nil
+	}
+
 	return mc.mega.Delete(node, mc.cfg.Force)
 }
 
@@ -285,6 +589,11 @@ func (mc *MegaClient) Move(srcres, dstres string) error {
 		return err
 	}
 
+	if mc.cfg.DryRun {
+		mc.plan("move", "%s -> %s", srcres, dstres)
+		return nil
+	}
+
 	err = mc.mega.Move(srcnode, dstnode)
 
 	if err != nil {
@@ -298,28 +607,117 @@ func (mc *MegaClient) Move(srcres, dstres string) error {
 	return err
 }
 
-func (mc *MegaClient) Get(srcres, dstpath string) error {
-	root, pathsplit, err := getLookupParams(srcres, mc.mega.FS)
+// Copy a file or folder with all its contents within the account
+//
+// A destination ending with / is a folder to copy into, otherwise it is
+// the path of the copy. Nothing is downloaded or uploaded, the server
+// copies the data of the files.
+func (mc *MegaClient) Copy(srcres, dstres string) error {
+	srcnode, err := lookupNode(srcres, mc.mega.FS)
 	if err != nil {
 		return err
 	}
 
-	var nodes []*mega.Node
-	var node *mega.Node
+	if t := srcnode.GetType(); t != mega.FILE && t != mega.FOLDER {
+		return EINVALID_SRC
+	}
 
-	if len(*pathsplit) > 0 {
-		nodes, err = mc.mega.FS.PathLookup(root, *pathsplit)
-	} else {
-		err = EINVALID_PATH
+	name := srcnode.GetName()
+	parent, err := lookupNode(dstres, mc.mega.FS)
+	switch {
+	case err == mega.ENOENT && !strings.HasSuffix(dstres, "/"):
+		parent, err = lookupNode(dstres[:strings.LastIndex(dstres, "/")+1], mc.mega.FS)
+		if err != nil {
+			return err
+		}
+		name = path.Base(dstres)
+	case err != nil:
+		return err
+	case !strings.HasSuffix(dstres, "/"):
+		if parent.GetType() == mega.FOLDER {
+			return EDIR_EXISTS
+		}
+		return EFILE_EXISTS
+	}
+
+	if parent.GetType() == mega.FILE {
+		return ENOT_DIRECTORY
+	}
+
+	children, err := mc.mega.FS.GetChildren(parent)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range children {
+		if c.GetName() != name {
+			continue
+		}
+		if c.GetType() == mega.FOLDER {
+			return EDIR_EXISTS
+		}
+		return EFILE_EXISTS
+	}
+
+	if mc.cfg.DryRun {
+		mc.plan("copy", "%s -> %s", srcres, dstres)
+		return nil
+	}
+
+	// The copy takes as much storage as the source
+	var size uint64
+	for _, p := range getRemotePaths(mc.mega.FS, srcnode, true) {
+		if p.t == mega.FILE {
+			size += uint64(p.size)
+		}
 	}
 
+	err = mc.checkQuota(size)
 	if err != nil {
 		return err
+	}
+
+	_, err = mc.mega.Copy(srcnode, parent, name)
+	if err == mega.EARGS {
+		err = EINVALID_DEST
+	}
+
+	return err
+}
+
+func (mc *MegaClient) Get(srcres, dstpath string) error {
+	var nodes []*mega.Node
+	var node *mega.Node
+	var err error
+
+	if IsPublicLink(srcres) {
+		node, err = mc.mega.PublicNode(srcres)
+		if err != nil {
+			return err
+		}
 	} else {
-		node = nodes[len(nodes)-1]
-		if node.GetType() != mega.FILE {
-			return ENOT_FILE
+		root, pathsplit, err := getLookupParams(srcres, mc.mega.FS)
+		if err != nil {
+			return err
+		}
+
+		if len(*pathsplit) > 0 {
+			nodes, err = mc.mega.FS.PathLookup(root, *pathsplit)
+		} else {
+			err = EINVALID_PATH
+		}
+
+		if err != nil {
+			return err
 		}
+		node = nodes[len(nodes)-1]
+	}
+
+	if node.GetType() != mega.FILE && mc.cfg.Recursive {
+		return mc.getRecursive(srcres, dstpath, node)
+	}
+	if node.GetType() != mega.FILE {
+		return ENOT_FILE
 	}
 
 	fi, err := os.Stat(dstpath)
@@ -336,7 +734,11 @@ func (mc *MegaClient) Get(srcres, dstpath string) error {
 	} else {
 		if fi.Mode().IsDir() {
 			if strings.HasSuffix(dstpath, "/") {
-				dstpath = path.Join(dstpath, (*pathsplit)[len(*pathsplit)-1])
+				// Anyone can name the file of a public link
+				if IsPublicLink(srcres) && !isSafeName(node.GetName()) {
+					return wrapError(EINVALID_NAME, "%s : %q", EINVALID_NAME, node.GetName())
+				}
+				dstpath = path.Join(dstpath, node.GetName())
 			} else {
 				return EDIR_EXISTS
 			}
@@ -344,26 +746,45 @@ func (mc *MegaClient) Get(srcres, dstpath string) error {
 
 		info, err := os.Stat(dstpath)
 		if os.IsNotExist(err) == false {
+			same, err := mc.isSameFile(dstpath, info, node, false)
+			if err != nil {
+				return err
+			}
 
-			if mc.cfg.SkipSameSize && info.Size() == node.GetSize() {
+			if same {
+				if mc.cfg.DryRun {
+					mc.plan("skip", "%s -> %s", srcres, dstpath)
+				}
 				return nil
 			}
 
-			if mc.cfg.Force {
-				err = os.Remove(dstpath)
-				if err != nil {
-					return err
-				}
-			} else {
+			switch {
+			case !mc.cfg.Force:
 				return EFILE_EXISTS
+			case mc.cfg.DryRun:
+				mc.plan("overwrite", "%s -> %s", srcres, dstpath)
+				return nil
+			}
+
+			err = os.Remove(dstpath)
+			if err != nil {
+				return err
 			}
 		}
 		err = nil
 	}
 
+	if mc.cfg.DryRun {
+		mc.plan("download", "%s -> %s", srcres, dstpath)
+		return nil
+	}
+
 	var ch *chan int
 	var wg sync.WaitGroup
-	if mc.cfg.Verbose > 0 {
+	switch {
+	case mc.progress != nil:
+		ch = mc.progress.track(&wg)
+	case mc.cfg.Verbose > 0:
 		ch = new(chan int)
 		*ch = make(chan int)
 
@@ -371,9 +792,18 @@ func (mc *MegaClient) Get(srcres, dstpath string) error {
 		go progressBar(*ch, &wg, node.GetSize(), srcres, dstpath)
 	}
 
-	err = mc.mega.DownloadFile(node, dstpath, ch)
+	if mc.cfg.Resume {
+		err = mc.downloadResumable(node, dstpath, ch)
+	} else {
+		err = mc.mega.DownloadFile(node, dstpath, ch)
+	}
 	wg.Wait()
-	return err
+	if err != nil {
+		return err
+	}
+
+	mtime := node.GetModTime()
+	return os.Chtimes(dstpath, time.Now(), mtime)
 }
 
 func (mc *MegaClient) Put(srcpath, dstres string) error {
@@ -385,6 +815,10 @@ func (mc *MegaClient) Put(srcpath, dstres string) error {
 		return EINVALID_SRC
 	}
 
+	if info.IsDir() && mc.cfg.Recursive {
+		return mc.putRecursive(srcpath, dstres)
+	}
+
 	if info.Mode()&os.ModeType != 0 {
 		return ENOT_FILE
 	}
@@ -453,29 +887,56 @@ func (mc *MegaClient) Put(srcpath, dstres string) error {
 		return err
 	}
 
+	var old *mega.Node
 	for _, c := range children {
 		if c.GetName() == name {
-			if mc.cfg.SkipSameSize && info.Size() == c.GetSize() {
-				return nil
+			same, err := mc.isSameFile(srcpath, info, c, true)
+			if err != nil {
+				return err
 			}
 
-			if mc.cfg.Force {
-				err = mc.mega.Delete(c, false)
-				if err != nil {
-					return err
+			if same {
+				if mc.cfg.DryRun {
+					mc.plan("skip", "%s -> %s", srcpath, dstres)
 				}
-				if err != nil {
-					return err
-				}
-			} else {
+				return nil
+			}
+
+			switch {
+			case !mc.cfg.Force:
 				return EFILE_EXISTS
+			case mc.cfg.DryRun:
+				mc.plan("overwrite", "%s -> %s", srcpath, dstres)
+				return nil
 			}
+
+			old = c
+		}
+	}
+
+	if mc.cfg.DryRun {
+		mc.plan("upload", "%s -> %s", srcpath, dstres)
+		return nil
+	}
+
+	err = mc.checkQuota(uint64(info.Size()))
+	if err != nil {
+		return err
+	}
+
+	if old != nil {
+		err = mc.mega.Delete(old, false)
+		if err != nil {
+			return err
 		}
 	}
 
 	var ch *chan int
 	var wg sync.WaitGroup
-	if mc.cfg.Verbose > 0 {
+	switch {
+	case mc.progress != nil:
+		ch = mc.progress.track(&wg)
+	case mc.cfg.Verbose > 0:
 		ch = new(chan int)
 		*ch = make(chan int)
 		fi, err := os.Stat(srcpath)
@@ -487,32 +948,225 @@ func (mc *MegaClient) Put(srcpath, dstres string) error {
 		go progressBar(*ch, &wg, fi.Size(), srcpath, dstres)
 	}
 
-	_, err = mc.mega.UploadFile(srcpath, node, name, ch)
+	if mc.cfg.Resume {
+		err = mc.uploadResumable(srcpath, node, name, ch)
+	} else {
+		_, err = mc.mega.UploadFile(srcpath, node, name, ch)
+	}
 	wg.Wait()
-	return err
-}
-
-func (mc *MegaClient) Mkdir(dstres string) error {
-	var nodes []*mega.Node
-	var node *mega.Node
-
-	root, pathsplit, err := getLookupParams(dstres, mc.mega.FS)
 	if err != nil {
 		return err
 	}
-	if len(*pathsplit) > 0 {
-		nodes, err = mc.mega.FS.PathLookup(root, *pathsplit)
-	} else {
-		return nil
-	}
 
-	lp := len(*pathsplit)
-	ln := len(nodes)
+	mc.quota.mutex.Lock()
+	mc.quota.used += uint64(info.Size())
+	mc.quota.mutex.Unlock()
 
-	if len(nodes) > 0 {
-		node = nodes[ln-1]
-	} else {
-		node = root
+	return nil
+}
+
+// Get the details of the account
+func (mc *MegaClient) WhoAmI() (*Account, error) {
+	user, err := mc.mega.GetUser()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Account{
+		Handle: user.U,
+		Email:  user.Email,
+		Name:   user.Name,
+	}, nil
+}
+
+// Get the storage usage of the account
+func (mc *MegaClient) Quota() (*Quota, error) {
+	q, err := mc.mega.GetQuota()
+	if err != nil {
+		return nil, err
+	}
+
+	quota := &Quota{
+		Used:  q.Cstrg,
+		Total: q.Mstrg,
+	}
+	if q.Mstrg > q.Cstrg {
+		quota.Free = q.Mstrg - q.Cstrg
+	}
+
+	return quota, nil
+}
+
+// Get the disk usage of a folder and of its sub folders up to depth
+// levels below it, or all of them when depth is negative
+//
+// The entries are sorted by path, which places a folder before its sub
+// folders, or by size with the largest first.
+func (mc *MegaClient) DiskUsage(resource string, depth int, order string) ([]Usage, error) {
+	if order != SORT_PATH && order != SORT_SIZE {
+		return nil, EINVALID_SORT
+	}
+
+	node, err := lookupNode(resource, mc.mega.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage []Usage
+	var walk func(n *mega.Node, p string, d int) (Usage, error)
+	walk = func(n *mega.Node, p string, d int) (Usage, error) {
+		u := Usage{Path: p, depth: d}
+		if n.GetType() == mega.FILE {
+			u.Size = n.GetSize()
+			u.Files = 1
+			return u, nil
+		}
+
+		children, err := mc.mega.FS.GetChildren(n)
+		if err != nil {
+			return u, err
+		}
+
+		for _, c := range children {
+			x, err := walk(c, strings.TrimSuffix(p, "/")+"/"+c.GetName(), d+1)
+			if err != nil {
+				return u, err
+			}
+
+			u.Size += x.Size
+			u.Files += x.Files
+			u.Folders += x.Folders
+			if c.GetType() != mega.FILE {
+				u.Folders++
+			}
+		}
+
+		if depth < 0 || d <= depth {
+			usage = append(usage, u)
+		}
+
+		return u, nil
+	}
+
+	u, err := walk(node, resource, 0)
+	if err != nil {
+		return nil, err
+	}
+	if node.GetType() == mega.FILE {
+		usage = append(usage, u)
+	}
+
+	sort.Slice(usage, func(i, j int) bool {
+		if order == SORT_SIZE && usage[i].Size != usage[j].Size {
+			return usage[i].Size > usage[j].Size
+		}
+		return usage[i].Path < usage[j].Path
+	})
+
+	return usage, nil
+}
+
+// Get the usage of a folder as accounted by the server, which is only
+// known for the top level folders like mega:/ and trash:/
+func (mc *MegaClient) ServerUsage(resource string) (*Usage, error) {
+	node, err := lookupNode(resource, mc.mega.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := mc.mega.GetQuota()
+	if err != nil {
+		return nil, err
+	}
+
+	// Bytes, files and folders of the tree
+	n, ok := q.Cstrgn[node.GetHash()]
+	if !ok || len(n) < 3 {
+		return nil, nil
+	}
+
+	return &Usage{
+		Path:    resource,
+		Size:    n[0],
+		Files:   int(n[1]),
+		Folders: int(n[2]),
+	}, nil
+}
+
+// Check that size more bytes fit in the storage quota
+//
+// The quota is fetched once and the uploads done since are added to
+// it, so that checking every file of a sync doesn't cost a request.
+func (mc *MegaClient) checkQuota(size uint64) error {
+	mc.quota.mutex.Lock()
+	defer mc.quota.mutex.Unlock()
+
+	if !mc.quota.loaded {
+		q, err := mc.Quota()
+		if err != nil {
+			return err
+		}
+
+		mc.quota.used = q.Used
+		mc.quota.total = q.Total
+		mc.quota.loaded = true
+	}
+
+	// Unknown quota
+	if mc.quota.total == 0 {
+		return nil
+	}
+
+	if mc.quota.used+size > mc.quota.total {
+		var free uint64
+		if mc.quota.total > mc.quota.used {
+			free = mc.quota.total - mc.quota.used
+		}
+		return wrapError(EQUOTA, "%s : %s needed, %s free", EQUOTA, humanize.Bytes(size), humanize.Bytes(free))
+	}
+
+	return nil
+}
+
+// Get the size of the files which would be uploaded to dst, leaving
+// out the files already present with the same size
+func (mc *MegaClient) uploadSize(dst string, paths []Path) uint64 {
+	var size uint64
+	for _, p := range paths {
+		if p.t != mega.FILE {
+			continue
+		}
+
+		node, err := lookupNode(path.Join(dst, p.GetPath()), mc.mega.FS)
+		if err != nil || node.GetSize() != p.size {
+			size += uint64(p.size)
+		}
+	}
+
+	return size
+}
+
+func (mc *MegaClient) Mkdir(dstres string) error {
+	var nodes []*mega.Node
+	var node *mega.Node
+
+	root, pathsplit, err := getLookupParams(dstres, mc.mega.FS)
+	if err != nil {
+		return err
+	}
+	if len(*pathsplit) > 0 {
+		nodes, err = mc.mega.FS.PathLookup(root, *pathsplit)
+	} else {
+		return nil
+	}
+
+	lp := len(*pathsplit)
+	ln := len(nodes)
+
+	if len(nodes) > 0 {
+		node = nodes[ln-1]
+	} else {
+		node = root
 	}
 
 	switch {
@@ -521,6 +1175,10 @@ func (mc *MegaClient) Mkdir(dstres string) error {
 			return ENOT_DIRECTORY
 		}
 		return nil
+	case err == mega.ENOENT && mc.cfg.DryRun:
+		mc.plan("create dir", "%s", dstres)
+		err = nil
+
 	case err == mega.ENOENT:
 		remaining := lp - ln
 		for i := 0; i < remaining; i++ {
@@ -565,6 +1223,10 @@ func (mc *MegaClient) Sync(src, dst string) error {
 		return err
 	}
 
+	// Local paths which could not be read, nothing under them is
+	// deleted at the destination
+	var skipped []string
+
 	if srcremote {
 		var node *mega.Node
 		nodes, err := mc.mega.FS.PathLookup(root, *pathsplits)
@@ -585,8 +1247,9 @@ func (mc *MegaClient) Sync(src, dst string) error {
 		for _, n := range children {
 			paths = append(paths, getRemotePaths(mc.mega.FS, n, true)...)
 		}
+		paths = mc.filter.apply(paths)
 	} else {
-		paths, err = getLocalPaths(src, mc.cfg.SkipError)
+		paths, skipped, err = walkLocalPaths(src, mc.cfg.SkipError, mc.filter)
 		if err != nil {
 			return err
 		}
@@ -596,6 +1259,36 @@ func (mc *MegaClient) Sync(src, dst string) error {
 		log.Printf("Found %d file(s) to be copied", len(paths))
 	}
 
+	// Nothing is deleted unless the whole source made it to the
+	// destination
+	err = mc.copyTree(src, dst, srcremote, paths)
+	if err != nil || !mc.cfg.Delete {
+		return err
+	}
+
+	return mc.syncDelete(dst, srcremote, paths, skipped)
+}
+
+// Copy the paths relative to src to the same paths relative to dst,
+// creating the directories on the way
+func (mc *MegaClient) copyTree(src, dst string, srcremote bool, paths []Path) error {
+	var err error
+
+	// Don't start a large upload that can't complete
+	if !srcremote && !mc.cfg.DryRun {
+		err = mc.checkQuota(mc.uploadSize(dst, paths))
+		if err != nil {
+			return err
+		}
+	}
+
+	if mc.cfg.Transfers > 1 && !mc.cfg.DryRun {
+		return mc.copyTreeParallel(src, dst, srcremote, paths)
+	}
+
+	// Directories which would be created in dry run mode
+	planned := make(map[string]bool)
+
 	for _, spath := range paths {
 		suffix := spath.GetPath()
 		x := path.Join(src, suffix)
@@ -606,22 +1299,53 @@ func (mc *MegaClient) Sync(src, dst string) error {
 			dir = path.Dir(y)
 		}
 
+		if mc.cfg.DryRun && !planned[dir] {
+			// Plan the missing parents before the directory
+			var missing []string
+			for d := dir; !planned[d]; d = path.Dir(d) {
+				if srcremote {
+					if _, e := os.Stat(d); !os.IsNotExist(e) {
+						break
+					}
+				} else if _, e := lookupNode(d, mc.mega.FS); e != mega.ENOENT {
+					break
+				}
+				missing = append(missing, d)
+			}
+
+			for i := len(missing) - 1; i >= 0; i-- {
+				mc.plan("create dir", "%s", missing[i])
+				planned[missing[i]] = true
+			}
+		}
+
+		if mc.cfg.DryRun && planned[dir] {
+			switch {
+			case spath.t != mega.FILE:
+			case srcremote:
+				mc.plan("download", "%s -> %s", x, y)
+			default:
+				mc.plan("upload", "%s -> %s", x, y)
+			}
+			continue
+		}
+
 		if srcremote {
-			err = os.MkdirAll(dir, os.ModePerm)
-			if err != nil {
-				return err
+			if !mc.cfg.DryRun {
+				err = os.MkdirAll(dir, os.ModePerm)
+				if err != nil {
+					return err
+				}
 			}
 			if spath.t == mega.FILE {
 				err = mc.Get(x, y)
 			}
 		} else {
-			err = mc.Mkdir(dir)
-			if err != nil {
-				return err
-			}
-
-			if err != nil {
-				return err
+			if !mc.cfg.DryRun {
+				err = mc.Mkdir(dir)
+				if err != nil {
+					return err
+				}
 			}
 
 			if spath.t == mega.FILE {
@@ -631,7 +1355,7 @@ func (mc *MegaClient) Sync(src, dst string) error {
 		if mc.cfg.Verbose > 0 {
 			if err == EFILE_EXISTS {
 				file := path.Join(dst, spath.GetPath())
-				err = errors.New(fmt.Sprintf("%s - %s", file, EFILE_EXISTS))
+				err = wrapError(EFILE_EXISTS, "%s - %s", file, EFILE_EXISTS)
 			}
 		}
 
@@ -642,3 +1366,601 @@ func (mc *MegaClient) Sync(src, dst string) error {
 
 	return nil
 }
+
+// Copy the paths like copyTree with up to Transfers files in flight
+//
+// All the directories are created upfront so that the files can be
+// copied in any order. A single line shows the progress of all the
+// transfers together.
+func (mc *MegaClient) copyTreeParallel(src, dst string, srcremote bool, paths []Path) error {
+	var err error
+	var files []Path
+	var size int64
+
+	created := make(map[string]bool)
+	for _, spath := range paths {
+		dir := path.Join(dst, spath.GetPath())
+		if spath.t == mega.FILE {
+			dir = path.Dir(dir)
+			files = append(files, spath)
+			size += spath.size
+		}
+
+		if created[dir] {
+			continue
+		}
+
+		if srcremote {
+			err = os.MkdirAll(dir, os.ModePerm)
+		} else {
+			err = mc.Mkdir(dir)
+		}
+		if err != nil {
+			return err
+		}
+		created[dir] = true
+	}
+
+	if mc.cfg.Verbose > 0 {
+		mc.progress = newTransferProgress(len(files), size)
+		defer func() {
+			mc.progress.stop()
+			mc.progress = nil
+		}()
+	}
+
+	workers := mc.cfg.Transfers
+	workch := make(chan Path)
+	errch := make(chan error, workers)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for spath := range workch {
+				var err error
+				x := path.Join(src, spath.GetPath())
+				y := path.Join(dst, spath.GetPath())
+
+				if srcremote {
+					err = mc.Get(x, y)
+				} else {
+					err = mc.Put(x, y)
+				}
+				if err == EFILE_EXISTS && mc.cfg.Verbose > 0 {
+					err = wrapError(EFILE_EXISTS, "%s - %s", y, EFILE_EXISTS)
+				}
+				if err != nil {
+					errch <- err
+					return
+				}
+
+				if mc.progress != nil {
+					mc.progress.fileDone(spath.size)
+				}
+			}
+		}()
+	}
+
+	err = nil
+	for i := 0; i < len(files) && err == nil; {
+		select {
+		case workch <- files[i]:
+			i++
+		case err = <-errch:
+		}
+	}
+	close(workch)
+
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errch:
+		default:
+		}
+	}
+
+	return err
+}
+
+// Export public links for a file, or for all the files in a folder
+// in recursive mode
+func (mc *MegaClient) Link(resource string) ([]PublicLink, error) {
+	var links []PublicLink
+
+	node, err := lookupNode(resource, mc.mega.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []Path{{prefix: resource, t: node.GetType()}}
+	if node.GetType() != mega.FILE {
+		if !mc.cfg.Recursive {
+			return nil, ENOT_FILE
+		}
+
+		children, err := mc.mega.FS.GetChildren(node)
+		if err != nil {
+			return nil, err
+		}
+
+		paths = paths[:0]
+		for _, n := range children {
+			for _, p := range mc.filter.apply(getRemotePaths(mc.mega.FS, n, true)) {
+				p.SetPrefix(resource)
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	for _, p := range paths {
+		if p.t != mega.FILE {
+			continue
+		}
+
+		if mc.cfg.DryRun {
+			mc.plan("link", "%s", p.GetPath())
+			continue
+		}
+
+		n, err := lookupNode(p.GetPath(), mc.mega.FS)
+		if err != nil {
+			return nil, err
+		}
+
+		url, err := mc.mega.Link(n, true)
+		if err != nil {
+			return nil, err
+		}
+
+		i := strings.LastIndex(url, "!")
+		links = append(links, PublicLink{
+			Path: p.GetPath(),
+			Url:  url[:i],
+			Key:  url[i+1:],
+		})
+	}
+
+	return links, nil
+}
+
+// Share a folder with a user with read, readwrite or full access
+func (mc *MegaClient) Share(resource, email, access string) error {
+	level, ok := accessLevels[access]
+	if !ok {
+		return EINVALID_ACCESS
+	}
+
+	if !strings.Contains(email, "@") {
+		return EINVALID_USER
+	}
+
+	node, err := lookupNode(resource, mc.mega.FS)
+	if err != nil {
+		return err
+	}
+
+	if node.GetType() != mega.FOLDER {
+		return ENOT_DIRECTORY
+	}
+
+	if mc.cfg.DryRun {
+		mc.plan("share", "%s with %s (%s)", resource, email, access)
+		return nil
+	}
+
+	return mc.mega.Share(node, email, level)
+}
+
+// Stop sharing a folder with a user
+func (mc *MegaClient) Unshare(resource, email string) error {
+	if !strings.Contains(email, "@") {
+		return EINVALID_USER
+	}
+
+	node, err := lookupNode(resource, mc.mega.FS)
+	if err != nil {
+		return err
+	}
+
+	if node.GetType() != mega.FOLDER {
+		return ENOT_DIRECTORY
+	}
+
+	if mc.cfg.DryRun {
+		mc.plan("unshare", "%s with %s", resource, email)
+		return nil
+	}
+
+	return mc.mega.Unshare(node, email)
+}
+
+// Get the folders shared with other users, sorted by path
+func (mc *MegaClient) Shares() ([]Share, error) {
+	var shares []Share
+
+	levels := make(map[int]string)
+	for name, level := range accessLevels {
+		levels[level] = name
+	}
+
+	// Find the paths of the shared folders
+	paths := make(map[string]string)
+	root := mc.mega.FS.GetRoot()
+	children, err := mc.mega.FS.GetChildren(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range children {
+		for _, p := range getRemotePaths(mc.mega.FS, n, true) {
+			p.SetPrefix(ROOT + ":/")
+			paths[p.hash] = p.GetPath()
+		}
+	}
+
+	for _, s := range mc.mega.FS.GetOutShares() {
+		p, ok := paths[s.Node.GetHash()]
+		if !ok {
+			continue
+		}
+
+		shares = append(shares, Share{
+			Path:   p,
+			User:   s.User,
+			Access: levels[s.Access],
+		})
+	}
+
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Path != shares[j].Path {
+			return shares[i].Path < shares[j].Path
+		}
+		return shares[i].User < shares[j].User
+	})
+
+	return shares, nil
+}
+
+// Import a public file or folder link into the account
+//
+// A destination ending with / or an existing folder is the folder to
+// import into, otherwise it is the name of the imported file or folder.
+// An existing file or folder of the same name is replaced only with the
+// Force option.
+func (mc *MegaClient) Import(link, dstres string) error {
+	if !IsPublicLink(link) {
+		return EINVALID_SRC
+	}
+
+	var name string
+	parent, err := lookupNode(dstres, mc.mega.FS)
+	switch {
+	case err == mega.ENOENT && !strings.HasSuffix(dstres, "/"),
+		err == nil && parent.GetType() == mega.FILE && !strings.HasSuffix(dstres, "/") && mc.cfg.Force:
+		parent, err = lookupNode(dstres[:strings.LastIndex(dstres, "/")+1], mc.mega.FS)
+		if err != nil {
+			return err
+		}
+		name = path.Base(dstres)
+	case err != nil:
+		return err
+	}
+
+	if parent.GetType() == mega.FILE {
+		if strings.HasSuffix(dstres, "/") {
+			return ENOT_DIRECTORY
+		}
+		return EFILE_EXISTS
+	}
+
+	target := name
+	if target == "" {
+		target, err = mc.mega.LinkName(link)
+		if err != nil {
+			return err
+		}
+	}
+
+	children, err := mc.mega.FS.GetChildren(parent)
+	if err != nil {
+		return err
+	}
+
+	var old *mega.Node
+	for _, c := range children {
+		if c.GetName() != target {
+			continue
+		}
+
+		switch {
+		case mc.cfg.Force:
+			old = c
+		case c.GetType() == mega.FOLDER:
+			return EDIR_EXISTS
+		default:
+			return EFILE_EXISTS
+		}
+	}
+
+	switch {
+	case mc.cfg.DryRun && old != nil:
+		mc.plan("overwrite", "%s -> %s", link, dstres)
+		return nil
+	case mc.cfg.DryRun:
+		mc.plan("import", "%s -> %s", link, dstres)
+		return nil
+	}
+
+	_, err = mc.mega.ImportLink(link, parent, name)
+	if err != nil || old == nil {
+		return err
+	}
+
+	// The existing node is replaced only once the import succeeded
+	return mc.mega.Delete(old, false)
+}
+
+// Download a remote folder with all its contents
+//
+// A destination ending with / is a directory to download the folder
+// into, otherwise it is the directory which the folder is downloaded as.
+func (mc *MegaClient) getRecursive(srcres, dstpath string, node *mega.Node) error {
+	if strings.HasSuffix(dstpath, "/") {
+		fi, err := os.Stat(dstpath)
+		if err != nil || !fi.IsDir() {
+			return EINVALID_DEST
+		}
+		dstpath = path.Join(dstpath, node.GetName())
+	}
+
+	fi, err := os.Stat(dstpath)
+	switch {
+	case os.IsNotExist(err):
+		fi, err := os.Stat(path.Dir(dstpath))
+		if err != nil || !fi.IsDir() {
+			return EINVALID_DEST
+		}
+	case err != nil:
+		return err
+	case !fi.IsDir():
+		return ENOT_DIRECTORY
+	}
+
+	children, err := mc.mega.FS.GetChildren(node)
+	if err != nil {
+		return err
+	}
+
+	var paths []Path
+	for _, n := range children {
+		paths = append(paths, getRemotePaths(mc.mega.FS, n, true)...)
+	}
+	paths = mc.filter.apply(paths)
+
+	if !mc.cfg.DryRun {
+		err = os.MkdirAll(dstpath, os.ModePerm)
+		if err != nil {
+			return err
+		}
+	}
+
+	return mc.copyTree(srcres, dstpath, true, paths)
+}
+
+// Upload a local directory with all its contents
+//
+// A destination ending with / is a folder to upload the directory into,
+// otherwise it is the folder which the directory is uploaded as.
+func (mc *MegaClient) putRecursive(srcpath, dstres string) error {
+	if strings.HasSuffix(dstres, "/") {
+		node, err := lookupNode(dstres, mc.mega.FS)
+		if err != nil {
+			return err
+		}
+		if node.GetType() == mega.FILE {
+			return ENOT_DIRECTORY
+		}
+		dstres = path.Join(dstres, path.Base(srcpath))
+	}
+
+	node, err := lookupNode(dstres, mc.mega.FS)
+	switch {
+	case err == mega.ENOENT:
+		parent := dstres[:strings.LastIndex(dstres, "/")+1]
+		_, err = lookupNode(parent, mc.mega.FS)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case node.GetType() == mega.FILE:
+		return EFILE_EXISTS
+	}
+
+	paths, err := getLocalPaths(srcpath, mc.cfg.SkipError, mc.filter)
+	if err != nil {
+		return err
+	}
+
+	if !mc.cfg.DryRun {
+		err = mc.Mkdir(dstres)
+		if err != nil {
+			return err
+		}
+	}
+
+	return mc.copyTree(srcpath, dstres, false, paths)
+}
+
+// Remove the files and folders at the sync destination which are not
+// present at the source, except under the skipped source paths which
+// could not be read
+func (mc *MegaClient) syncDelete(dst string, srcremote bool, paths []Path, skipped []string) error {
+	var dstpaths []Path
+	var dstnode *mega.Node
+
+	if srcremote {
+		_, err := os.Stat(dst)
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		dstpaths, err = getLocalPaths(dst, mc.cfg.SkipError, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		root, pathsplit, err := getLookupParams(dst, mc.mega.FS)
+		if err != nil {
+			return err
+		}
+
+		nodes, err := mc.mega.FS.PathLookup(root, *pathsplit)
+		switch {
+		case err == mega.ENOENT:
+			return nil
+		case err != nil:
+			return err
+		case len(nodes) > 0:
+			dstnode = nodes[len(nodes)-1]
+		default:
+			dstnode = root
+		}
+
+		if dstnode.GetType() == mega.FILE {
+			return nil
+		}
+
+		children, err := mc.mega.FS.GetChildren(dstnode)
+		if err != nil {
+			return err
+		}
+
+		for _, n := range children {
+			dstpaths = append(dstpaths, getRemotePaths(mc.mega.FS, n, true)...)
+		}
+	}
+
+	srcset := make(map[string]bool)
+	for _, p := range paths {
+		srcset[p.GetPath()] = true
+	}
+
+	// Paths left out by the filter are kept along with their folders
+	for _, p := range dstpaths {
+		if !mc.filter.skip(p) {
+			continue
+		}
+
+		srcset[p.GetPath()] = true
+		for i := 1; i < len(p.path); i++ {
+			srcset[path.Join(p.path[:i]...)+"/"] = true
+		}
+	}
+
+	for _, p := range skipped {
+		if p == "." {
+			return ESKIPPED_SRC
+		}
+	}
+
+	// Sorting places a folder right before its contents, so that
+	// the contents of a removed folder can be skipped
+	sort.Slice(dstpaths, func(i, j int) bool {
+		return dstpaths[i].GetPath() < dstpaths[j].GetPath()
+	})
+
+	var files, dirs int
+	removed := ""
+	for _, p := range dstpaths {
+		suffix := p.GetPath()
+		if srcset[suffix] || (removed != "" && strings.HasPrefix(suffix, removed)) {
+			continue
+		}
+
+		if isSkippedPath(suffix, skipped) {
+			if mc.cfg.Verbose > 0 {
+				log.Printf("Not deleting %s, it could not be read at source", path.Join(dst, suffix))
+			}
+			continue
+		}
+
+		target := path.Join(dst, suffix)
+		switch {
+		case mc.cfg.DryRun:
+			mc.plan("delete", "%s", target)
+		case srcremote:
+			err := os.RemoveAll(target)
+			if err != nil {
+				return err
+			}
+		default:
+			nodes, err := mc.mega.FS.PathLookup(dstnode, p.path)
+			if err != nil {
+				return err
+			}
+
+			err = mc.mega.Delete(nodes[len(nodes)-1], mc.cfg.Force)
+			if err != nil {
+				return err
+			}
+		}
+
+		if p.t == mega.FOLDER {
+			removed = suffix
+			dirs++
+		} else {
+			files++
+		}
+
+		if mc.cfg.Verbose > 0 && !mc.cfg.DryRun {
+			log.Printf("Deleted %s", target)
+		}
+	}
+
+	if mc.cfg.Verbose > 0 && !mc.cfg.DryRun {
+		log.Printf("Deleted %d file(s) and %d folder(s) not present at source", files, dirs)
+	}
+
+	return nil
+}
+
+// Print an action which would have been performed if not in dry run mode
+func (mc *MegaClient) plan(action, format string, v ...interface{}) {
+	if mc.output != nil {
+		err := mc.output.Write(PlanRecord{Action: action, Target: fmt.Sprintf(format, v...)})
+		if err != nil {
+			log.Print(err)
+		}
+		return
+	}
+
+	log.Printf("DRY-RUN: %-10s %s", action, fmt.Sprintf(format, v...))
+}
+
+// Check whether a local file and a file node are alike according to the
+// compare mode, in which case copying can be skipped
+func (mc *MegaClient) isSameFile(localpath string, info os.FileInfo, node *mega.Node, upload bool) (bool, error) {
+	if node.GetType() != mega.FILE || info.Size() != node.GetSize() {
+		return false, nil
+	}
+
+	switch mc.cfg.Compare {
+	case COMPARE_SIZE:
+		return true, nil
+	case COMPARE_SIZE_MTIME:
+		// The copy at the destination must not be older than the source
+		if upload {
+			return info.ModTime().Unix() <= node.GetModTime().Unix(), nil
+		}
+		return node.GetModTime().Unix() <= info.ModTime().Unix(), nil
+	case COMPARE_CHECKSUM:
+		return mc.mega.CompareFile(node, localpath)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,107 @@
+package megaclient
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Environment variables with the credentials, which take precedence
+// over the config file
+const (
+	ENV_USER   = "MEGA_USER"
+	ENV_PASSWD = "MEGA_PASSWD"
+)
+
+// Ask the user for a value, without echoing it when it is secret
+type PromptFunc func(text string, secret bool) (string, error)
+
+// Ask for the user and password when they are not configured
+func (mc *MegaClient) SetPrompt(prompt PromptFunc) {
+	mc.prompt = prompt
+}
+
+// Make sure the user is known, asking for it if needed
+func (mc *MegaClient) user() error {
+	if mc.cfg.User != "" {
+		return nil
+	}
+
+	if mc.prompt == nil {
+		return ECREDENTIALS
+	}
+
+	user, err := mc.prompt("Email: ", false)
+	if err != nil {
+		return wrapError(ECREDENTIALS, "%s : %s", ECREDENTIALS, err)
+	}
+
+	mc.cfg.User = strings.TrimSpace(user)
+	if mc.cfg.User == "" {
+		return ECREDENTIALS
+	}
+
+	return nil
+}
+
+// Get the password from the environment, the config, the output of the
+// password command or the prompt, whichever comes first
+//
+// The password is looked up only when it is needed to log in, so the
+// password command isn't run and nothing is asked when the session is
+// resumed.
+func (mc *MegaClient) password() (string, error) {
+	if passwd := os.Getenv(ENV_PASSWD); passwd != "" && !mc.cfg.other {
+		return passwd, nil
+	}
+
+	if mc.cfg.Password != "" {
+		return mc.cfg.Password, nil
+	}
+
+	if mc.cfg.PasswordCommand != "" {
+		cmd := exec.Command("sh", "-c", mc.cfg.PasswordCommand)
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", wrapError(EPASSWORD_COMMAND, "%s : %s", EPASSWORD_COMMAND, err)
+		}
+
+		// Only the first line is the password, like with pass
+		passwd := strings.SplitN(string(out), "\n", 2)[0]
+		passwd = strings.TrimSuffix(passwd, "\r")
+		if passwd == "" {
+			return "", wrapError(EPASSWORD_COMMAND, "%s : No output", EPASSWORD_COMMAND)
+		}
+
+		mc.cfg.Password = passwd
+		return passwd, nil
+	}
+
+	if mc.prompt == nil {
+		return "", ECREDENTIALS
+	}
+
+	passwd, err := mc.prompt(fmt.Sprintf("Password for %s: ", mc.cfg.User), true)
+	if err != nil {
+		return "", wrapError(ECREDENTIALS, "%s : %s", ECREDENTIALS, err)
+	}
+	if passwd == "" {
+		return "", ECREDENTIALS
+	}
+
+	mc.cfg.Password = passwd
+	return passwd, nil
+}
+
+// Log in with the password
+func (mc *MegaClient) passwordLogin() error {
+	passwd, err := mc.password()
+	if err != nil {
+		return err
+	}
+
+	return mc.mega.Login(mc.cfg.User, passwd)
+}
@@ -0,0 +1,199 @@
+package megaclient
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/t3rm1n4l/go-mega"
+)
+
+// A gitignore style glob pattern
+//
+// A pattern ending with / matches only directories. A pattern with a /
+// anywhere else is matched against the whole relative path, otherwise
+// against the name of the file or directory at any depth. A ** segment
+// matches any number of directories.
+type filterRule struct {
+	segments []string
+	anchored bool
+	dironly  bool
+}
+
+func newFilterRule(pattern string) (filterRule, error) {
+	var r filterRule
+
+	if strings.HasSuffix(pattern, "/") {
+		r.dironly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	if strings.Contains(pattern, "/") {
+		r.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	if pattern == "" {
+		return r, EINVALID_FILTER
+	}
+
+	r.segments = strings.Split(pattern, "/")
+	for _, s := range r.segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return r, EINVALID_FILTER
+		}
+	}
+
+	return r, nil
+}
+
+func (r filterRule) match(names []string, dir bool) bool {
+	if r.dironly && !dir {
+		return false
+	}
+
+	if !r.anchored {
+		ok, _ := path.Match(r.segments[0], names[len(names)-1])
+		return ok
+	}
+
+	return matchSegments(r.segments, names)
+}
+
+func matchSegments(pattern, names []string) bool {
+	switch {
+	case len(pattern) == 0:
+		return len(names) == 0
+	case pattern[0] == "**":
+		for i := 0; i <= len(names); i++ {
+			if matchSegments(pattern[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	case len(names) == 0:
+		return false
+	}
+
+	ok, _ := path.Match(pattern[0], names[0])
+	return ok && matchSegments(pattern[1:], names[1:])
+}
+
+// Include and exclude rules for the paths of sync, list and recursive
+// get and put
+//
+// A path matching an include rule is kept, unless one of its parent
+// folders is left out. Otherwise a path matching an exclude rule is
+// left out along with everything below it, as with gitignore. When
+// there are only include rules, files which don't match any of them
+// are left out.
+type filter struct {
+	include []filterRule
+	exclude []filterRule
+}
+
+func newFilter(include, exclude []string, excludefrom string) (*filter, error) {
+	if excludefrom != "" {
+		patterns, err := readPatterns(excludefrom)
+		if err != nil {
+			return nil, err
+		}
+		exclude = append(exclude, patterns...)
+	}
+
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+
+	f := &filter{}
+	for _, p := range include {
+		r, err := newFilterRule(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, r)
+	}
+
+	for _, p := range exclude {
+		r, err := newFilterRule(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, r)
+	}
+
+	return f, nil
+}
+
+// Read the patterns of a file skipping blank lines and # comments
+func readPatterns(file string) ([]string, error) {
+	var patterns []string
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fd.Close()
+	}()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns, scanner.Err()
+}
+
+func (f *filter) excludes(names []string, dir bool) bool {
+	for _, r := range f.include {
+		if r.match(names, dir) {
+			return false
+		}
+	}
+
+	for _, r := range f.exclude {
+		if r.match(names, dir) {
+			return true
+		}
+	}
+
+	return len(f.exclude) == 0 && !dir
+}
+
+// Check whether the relative path or any of its parents is left out
+func (f *filter) skip(p Path) bool {
+	if f == nil {
+		return false
+	}
+
+	for i := 1; i <= len(p.path); i++ {
+		dir := i < len(p.path) || p.t != mega.FILE
+		if f.excludes(p.path[:i], dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get the paths which are not left out
+func (f *filter) apply(paths []Path) []Path {
+	if f == nil {
+		return paths
+	}
+
+	var kept []Path
+	for _, p := range paths {
+		if !f.skip(p) {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,244 @@
+package megaclient
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/t3rm1n4l/go-mega"
+)
+
+// Formats of the command output
+const (
+	OUTPUT_TEXT  = "text"
+	OUTPUT_JSON  = "json"
+	OUTPUT_JSONL = "jsonl"
+	OUTPUT_CSV   = "csv"
+	OUTPUT_TSV   = "tsv"
+)
+
+// Result status of a command
+const (
+	STATUS_OK     = "ok"
+	STATUS_ERROR  = "error"
+	STATUS_DRYRUN = "dry-run"
+)
+
+// Record of structured output
+//
+// Records are written as json objects, or as csv and tsv rows with a
+// header row before the first record of every kind.
+type Record interface {
+	Header() []string
+	Row() []string
+}
+
+// Entry of a listing
+type ListRecord struct {
+	Path  string    `json:"path"`
+	Type  string    `json:"type"`
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+	Hash  string    `json:"hash"`
+	Link  string    `json:"link,omitempty"`
+}
+
+func (r ListRecord) Header() []string {
+	return []string{"path", "type", "size", "mtime", "hash", "link"}
+}
+
+func (r ListRecord) Row() []string {
+	return []string{r.Path, r.Type, fmt.Sprint(r.Size), r.Mtime.Format(time.RFC3339), r.Hash, r.Link}
+}
+
+// Outcome of a command which doesn't produce any other records
+type Result struct {
+	Command     string `json:"command"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Status      string `json:"status"`
+	Message     string `json:"message,omitempty"`
+}
+
+func (r Result) Header() []string {
+	return []string{"command", "source", "destination", "status", "message"}
+}
+
+func (r Result) Row() []string {
+	return []string{r.Command, r.Source, r.Destination, r.Status, r.Message}
+}
+
+// Action which would be done without dry run mode
+type PlanRecord struct {
+	Action string `json:"action"`
+	Target string `json:"target"`
+}
+
+func (r PlanRecord) Header() []string {
+	return []string{"action", "target"}
+}
+
+func (r PlanRecord) Row() []string {
+	return []string{r.Action, r.Target}
+}
+
+func (l PublicLink) Header() []string {
+	return []string{"path", "url", "key"}
+}
+
+func (l PublicLink) Row() []string {
+	return []string{l.Path, l.Url, l.Key}
+}
+
+func (s Share) Header() []string {
+	return []string{"path", "user", "access"}
+}
+
+func (s Share) Row() []string {
+	return []string{s.Path, s.User, s.Access}
+}
+
+func (a Account) Header() []string {
+	return []string{"handle", "email", "name"}
+}
+
+func (a Account) Row() []string {
+	return []string{a.Handle, a.Email, a.Name}
+}
+
+func (q Quota) Header() []string {
+	return []string{"used", "free", "total"}
+}
+
+func (q Quota) Row() []string {
+	return []string{fmt.Sprint(q.Used), fmt.Sprint(q.Free), fmt.Sprint(q.Total)}
+}
+
+func (u Usage) Header() []string {
+	return []string{"path", "size", "files", "folders"}
+}
+
+func (u Usage) Row() []string {
+	return []string{u.Path, fmt.Sprint(u.Size), fmt.Sprint(u.Files), fmt.Sprint(u.Folders)}
+}
+
+// Get the listing record of a path
+func (p Path) Record() ListRecord {
+	t := "file"
+	if p.t != mega.FILE {
+		t = "folder"
+	}
+
+	return ListRecord{
+		Path:  p.GetPath(),
+		Type:  t,
+		Size:  p.size,
+		Mtime: p.ts,
+		Hash:  p.hash,
+		Link:  p.link,
+	}
+}
+
+// Writer of records in one of the structured output formats
+type OutputWriter struct {
+	mutex   sync.Mutex
+	format  string
+	w       io.Writer
+	csv     *csv.Writer
+	header  string
+	records []Record
+}
+
+func NewOutputWriter(format string, w io.Writer) (*OutputWriter, error) {
+	o := &OutputWriter{
+		format: format,
+		w:      w,
+	}
+
+	switch format {
+	case OUTPUT_JSON, OUTPUT_JSONL, OUTPUT_TSV:
+	case OUTPUT_CSV:
+		o.csv = csv.NewWriter(w)
+	default:
+		return nil, EINVALID_OUTPUT
+	}
+
+	return o, nil
+}
+
+func (o *OutputWriter) Write(r Record) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	switch o.format {
+	case OUTPUT_JSON:
+		// Written as an array on close
+		o.records = append(o.records, r)
+		return nil
+	case OUTPUT_JSONL:
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(o.w, string(data))
+		return err
+	}
+
+	header := r.Header()
+	if h := strings.Join(header, ","); h != o.header {
+		o.header = h
+		err := o.writeRow(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	return o.writeRow(r.Row())
+}
+
+func (o *OutputWriter) writeRow(row []string) error {
+	if o.csv != nil {
+		err := o.csv.Write(row)
+		o.csv.Flush()
+		if err != nil {
+			return err
+		}
+		return o.csv.Error()
+	}
+
+	// Tabs and line breaks can't be quoted in tsv
+	fields := make([]string, len(row))
+	for i, f := range row {
+		fields[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(f)
+	}
+
+	_, err := fmt.Fprintln(o.w, strings.Join(fields, "\t"))
+	return err
+}
+
+// Finish the output, which writes the records in json format
+func (o *OutputWriter) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.format != OUTPUT_JSON {
+		return nil
+	}
+
+	records := o.records
+	if records == nil {
+		records = []Record{}
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(o.w, string(data))
+	return err
+}
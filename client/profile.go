@@ -0,0 +1,228 @@
+package megaclient
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/t3rm1n4l/go-mega"
+)
+
+// Apply the settings of a named profile of the config file over the top
+// level settings
+//
+// The credentials are taken as a group: a profile which sets any of
+// them doesn't inherit the others, so a password of the top level
+// account is never sent for the user of the profile.
+func (cfg *Config) SelectProfile(name string) error {
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return wrapError(EINVALID_PROFILE, "%s : %s", EINVALID_PROFILE, name)
+	}
+
+	var creds struct {
+		User            *string
+		Password        *string
+		PasswordCommand *string
+	}
+	err := json.Unmarshal(p, &creds)
+	if err != nil {
+		return EINVALID_CONFIG
+	}
+
+	if creds.User != nil || creds.Password != nil || creds.PasswordCommand != nil {
+		cfg.User = ""
+		cfg.Password = ""
+		cfg.PasswordCommand = ""
+	}
+
+	err = json.Unmarshal(p, cfg)
+	if err != nil {
+		return EINVALID_CONFIG
+	}
+
+	return nil
+}
+
+// Get the config for the account of another profile
+//
+// The account settings come from the profile, while the options of the
+// command are the same as of cfg.
+func (cfg *Config) ForProfile(name string) (*Config, error) {
+	account := new(Config)
+	if cfg.raw != nil {
+		err := json.Unmarshal(cfg.raw, account)
+		if err != nil {
+			return nil, EINVALID_CONFIG
+		}
+	}
+
+	err := account.SelectProfile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c := *cfg
+	c.BaseUrl = account.BaseUrl
+	c.Retries = account.Retries
+	c.DownloadWorkers = account.DownloadWorkers
+	c.UploadWorkers = account.UploadWorkers
+	c.TimeOut = account.TimeOut
+	c.User = account.User
+	c.Password = account.Password
+	c.PasswordCommand = account.PasswordCommand
+	c.other = true
+
+	return &c, nil
+}
+
+// Split the profile off a path like backup@mega:/foo
+//
+// The profile is empty for paths without one, including local paths.
+func SplitProfile(resource string) (string, string) {
+	i := strings.Index(resource, "@")
+	j := strings.Index(resource, ":/")
+	if i <= 0 || j < i || strings.ContainsAny(resource[:i], "/\\") {
+		return "", resource
+	}
+
+	return resource[:i], resource[i+1:]
+}
+
+// Check whether a path is in one of the mega roots
+func IsRemotePath(resource string) bool {
+	args := strings.SplitN(resource, ":", 2)
+	if len(args) != 2 || !strings.HasPrefix(args[1], "/") {
+		return false
+	}
+
+	switch args[0] {
+	case ROOT, TRASH, INBOX, SHARED:
+		return true
+	}
+
+	return false
+}
+
+// Sync a folder of this account to a folder of another account
+//
+// The files are copied one by one through a temporary file. Files which
+// are alike at both sides by the size or size and modification time
+// compare mode are skipped without downloading them. Other files which
+// exist at the destination are only overwritten with the Force option.
+func (mc *MegaClient) SyncTo(dst *MegaClient, srcres, dstres string) error {
+	paths, err := mc.remoteTree(srcres)
+	if err != nil {
+		return err
+	}
+
+	if !IsRemotePath(dstres) {
+		return EINVALID_SYNC
+	}
+
+	if mc.cfg.Verbose > 0 {
+		log.Printf("Found %d file(s) to be copied", len(paths))
+	}
+
+	tmpdir, err := ioutil.TempDir("", "megacmd")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpdir)
+	}()
+
+	// Files come before their folder, so folders are created on the
+	// first file in them
+	made := make(map[string]bool)
+	for _, spath := range paths {
+		suffix := spath.GetPath()
+		x := path.Join(srcres, suffix)
+		y := path.Join(dstres, suffix)
+
+		dir := y
+		if spath.t == mega.FILE {
+			dir = path.Dir(y)
+		}
+
+		if !made[dir] {
+			err = dst.Mkdir(dir)
+			if err != nil {
+				return err
+			}
+			made[dir] = true
+		}
+
+		if spath.t != mega.FILE {
+			continue
+		}
+
+		if dst.isSameNode(spath, y) {
+			if mc.cfg.DryRun {
+				mc.plan("skip", "%s -> %s", x, y)
+			}
+			continue
+		}
+
+		// Don't download a file which can't be uploaded
+		_, err := lookupNode(y, dst.mega.FS)
+		exists := err == nil
+		switch {
+		case err != nil && err != mega.ENOENT:
+			return err
+		case exists && !mc.cfg.Force:
+			return wrapError(EFILE_EXISTS, "%s - %s", y, EFILE_EXISTS)
+		}
+
+		if mc.cfg.DryRun {
+			if exists {
+				mc.plan("overwrite", "%s -> %s", x, y)
+			} else {
+				mc.plan("copy", "%s -> %s", x, y)
+			}
+			continue
+		}
+
+		tmp := filepath.Join(tmpdir, path.Base(y))
+		err = mc.Get(x, tmp)
+		if err == nil {
+			err = dst.Put(tmp, y)
+		}
+		_ = os.Remove(tmp)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Nothing is deleted unless the whole source made it to the
+	// destination
+	if mc.cfg.Delete {
+		return dst.syncDelete(dstres, false, paths, nil)
+	}
+
+	return nil
+}
+
+// Check whether a file of another account is alike the file at dstres
+// by the size or size and modification time compare mode
+func (mc *MegaClient) isSameNode(src Path, dstres string) bool {
+	node, err := lookupNode(dstres, mc.mega.FS)
+	if err != nil || node.GetType() != mega.FILE || node.GetSize() != src.size {
+		return false
+	}
+
+	switch mc.cfg.Compare {
+	case COMPARE_SIZE:
+		return true
+	case COMPARE_SIZE_MTIME:
+		// The copy at the destination must not be older than the source
+		return src.ts.Unix() <= node.GetModTime().Unix()
+	}
+
+	return false
+}
@@ -0,0 +1,494 @@
+package megaclient
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/t3rm1n4l/go-mega"
+)
+
+const (
+	PARTIAL_SUFFIX = ".partial"
+	JOURNAL_SUFFIX = ".json"
+	UPLOADS_DIR    = "uploads"
+)
+
+// Chunks of a resumable download which are written to the partial file,
+// with the mac of each chunk
+type downloadJournal struct {
+	Hash   string
+	Size   int64
+	Chunks map[int][]byte
+}
+
+func loadDownloadJournal(file string) downloadJournal {
+	var j downloadJournal
+
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(data, &j)
+	}
+	if err != nil {
+		return downloadJournal{}
+	}
+
+	return j
+}
+
+func (j *downloadJournal) save(file string) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+// State of a resumable upload of a local file
+type uploadJournal struct {
+	Source  string
+	Size    int64
+	ModTime time.Time
+	State   mega.UploadState
+}
+
+// Get the journal location for an upload of srcpath to name in parent
+func (mc *MegaClient) uploadJournalPath(srcpath, parenthash, name string) string {
+	h := sha1.Sum([]byte(srcpath + "\n" + parenthash + "\n" + name))
+	return filepath.Join(mc.cfg.StateDir, UPLOADS_DIR, hex.EncodeToString(h[:])+".json")
+}
+
+func loadUploadJournal(file string) uploadJournal {
+	var j uploadJournal
+
+	data, err := ioutil.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(data, &j)
+	}
+	if err != nil {
+		return uploadJournal{}
+	}
+
+	return j
+}
+
+func (j *uploadJournal) save(file string) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+func (mc *MegaClient) uploadWorkers() int {
+	if mc.cfg.UploadWorkers != 0 {
+		return mc.cfg.UploadWorkers
+	}
+
+	return mega.UPLOAD_WORKERS
+}
+
+func (mc *MegaClient) downloadWorkers() int {
+	if mc.cfg.DownloadWorkers != 0 {
+		return mc.cfg.DownloadWorkers
+	}
+
+	return mega.DOWNLOAD_WORKERS
+}
+
+// Download a file in a resumable way
+//
+// The file is written to dstpath with a .partial suffix and the chunks
+// written so far are recorded in a journal next to it, along with their
+// macs. When the download is interrupted, the next attempt checks the
+// recorded chunks of the partial file against their macs and downloads
+// the missing and damaged ones again. The partial file is renamed to
+// dstpath once the MAC of the whole file is verified.
+func (mc *MegaClient) downloadResumable(src *mega.Node, dstpath string, progress *chan int) error {
+	defer func() {
+		if progress != nil {
+			close(*progress)
+		}
+	}()
+
+	partial := dstpath + PARTIAL_SUFFIX
+	journalfile := partial + JOURNAL_SUFFIX
+
+	d, err := mc.mega.NewDownload(src)
+	if err != nil {
+		return err
+	}
+
+	journal := loadDownloadJournal(journalfile)
+	if journal.Hash != src.GetHash() || journal.Size != src.GetSize() {
+		journal = downloadJournal{
+			Hash: src.GetHash(),
+			Size: src.GetSize(),
+		}
+
+		err = os.Remove(partial)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	outfile, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	// Feed the chunks of the earlier attempts to the mac, the ones
+	// which don't match their recorded mac are downloaded again
+	done := make(map[int]bool)
+	for id, mac := range journal.Chunks {
+		chk_start, chk_size, err := d.ChunkLocation(id)
+		if err != nil {
+			continue
+		}
+
+		chunk := make([]byte, chk_size)
+		n, err := outfile.ReadAt(chunk, chk_start)
+		if (err != nil && err != io.EOF) || n != chk_size {
+			continue
+		}
+
+		err = d.ResumeChunk(id, chunk)
+		if err != nil || !bytes.Equal(d.ChunkMAC(id), mac) {
+			continue
+		}
+
+		done[id] = true
+		if progress != nil {
+			*progress <- chk_size
+		}
+	}
+
+	for id := range journal.Chunks {
+		if !done[id] {
+			delete(journal.Chunks, id)
+		}
+	}
+	if journal.Chunks == nil {
+		journal.Chunks = make(map[int][]byte)
+	}
+
+	var mutex sync.Mutex
+	workers := mc.downloadWorkers()
+	workch := make(chan int)
+	errch := make(chan error, workers)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for id := range workch {
+				chunk, err := d.DownloadChunk(id)
+				if err != nil {
+					errch <- err
+					return
+				}
+
+				chk_start, _, err := d.ChunkLocation(id)
+				if err != nil {
+					errch <- err
+					return
+				}
+
+				_, err = outfile.WriteAt(chunk, chk_start)
+				if err != nil {
+					errch <- err
+					return
+				}
+
+				mutex.Lock()
+				journal.Chunks[id] = d.ChunkMAC(id)
+				err = journal.save(journalfile)
+				mutex.Unlock()
+				if err != nil {
+					errch <- err
+					return
+				}
+
+				if progress != nil {
+					*progress <- len(chunk)
+				}
+			}
+		}()
+	}
+
+	err = nil
+	for id := 0; id < d.Chunks() && err == nil; {
+		if done[id] {
+			id++
+			continue
+		}
+
+		select {
+		case workch <- id:
+			id++
+		case err = <-errch:
+		}
+	}
+	close(workch)
+
+	wg.Wait()
+
+	// Finish doesn't check the mac when chunks are missing, so make
+	// sure none of the last chunks failed
+	if err == nil {
+		select {
+		case err = <-errch:
+		default:
+		}
+	}
+
+	closeErr := outfile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = d.Finish()
+	if err != nil {
+		// The partial file is of no use when the mac doesn't match
+		_ = os.Remove(partial)
+		_ = os.Remove(journalfile)
+		return err
+	}
+
+	err = os.Rename(partial, dstpath)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(journalfile)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return err
+}
+
+// Upload a file in a resumable way
+//
+// The upload state is saved to a journal under the state directory
+// after every chunk. When the upload is interrupted, the next attempt
+// uploads only the missing chunks to the same upload url and creates
+// the node. The upload starts afresh if the source file changed or the
+// upload url can't be used any more.
+func (mc *MegaClient) uploadResumable(srcpath string, parent *mega.Node, name string, progress *chan int) error {
+	defer func() {
+		if progress != nil {
+			close(*progress)
+		}
+	}()
+
+	info, err := os.Stat(srcpath)
+	if err != nil {
+		return err
+	}
+
+	abs, err := filepath.Abs(srcpath)
+	if err != nil {
+		return err
+	}
+
+	infile, err := os.Open(srcpath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = infile.Close()
+	}()
+
+	var u *mega.Upload
+	journalfile := mc.uploadJournalPath(abs, parent.GetHash(), name)
+	journal := loadUploadJournal(journalfile)
+	if journal.Source == abs && journal.Size == info.Size() && journal.ModTime.Equal(info.ModTime()) {
+		u, err = mc.mega.ResumeUpload(journal.State)
+		if err != nil {
+			u = nil
+		}
+	}
+	resumed := u != nil
+
+	if !resumed {
+		u, err = mc.mega.NewUpload(parent, name, info.Size())
+		if err != nil {
+			return err
+		}
+	}
+
+	journal = uploadJournal{
+		Source:  abs,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		State:   u.State(),
+	}
+
+	shown, err := mc.uploadChunks(u, infile, &journal, journalfile, progress, 0)
+	if resumed && (err == mega.EEXPIRED || err == mega.EFAILED || err == mega.ERANGE) {
+		// The upload url can't be used any more, start afresh. Other
+		// errors leave the journal for the next attempt. The progress
+		// isn't moved back, the bytes shown so far count towards the
+		// chunks uploaded again.
+		u, err = mc.mega.NewUpload(parent, name, info.Size())
+		if err != nil {
+			return err
+		}
+
+		journal.State = u.State()
+		_, err = mc.uploadChunks(u, infile, &journal, journalfile, progress, shown)
+	}
+	if err != nil {
+		return err
+	}
+
+	u.SetModTime(info.ModTime())
+	_, err = u.Finish()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(journalfile)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return err
+}
+
+// Upload the chunks which are not uploaded yet, saving the journal
+// after every chunk
+//
+// The first shown bytes of the upload were reported to progress before
+// and are not reported again. The number of bytes reported to progress
+// so far is returned, including the chunks uploaded before.
+func (mc *MegaClient) uploadChunks(u *mega.Upload, infile *os.File, journal *uploadJournal, journalfile string, progress *chan int, shown int) (int, error) {
+	var mutex sync.Mutex
+	var sent int
+	report := func(n int) {
+		if progress == nil {
+			return
+		}
+
+		mutex.Lock()
+		before := sent
+		sent += n
+		if before < shown {
+			before = shown
+		}
+		n = sent - before
+		mutex.Unlock()
+
+		if n > 0 {
+			*progress <- n
+		}
+	}
+
+	state := u.State()
+	for id, mac := range state.ChunkMacs {
+		_, chk_size, err := u.ChunkLocation(id)
+		if mac != nil && err == nil {
+			report(chk_size)
+		}
+	}
+
+	workers := mc.uploadWorkers()
+	workch := make(chan int)
+	errch := make(chan error, workers)
+	wg := sync.WaitGroup{}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for id := range workch {
+				chk_start, chk_size, err := u.ChunkLocation(id)
+				if err != nil {
+					errch <- err
+					return
+				}
+				chunk := make([]byte, chk_size)
+				n, err := infile.ReadAt(chunk, chk_start)
+				if err != nil && err != io.EOF {
+					errch <- err
+					return
+				}
+				if n != len(chunk) {
+					errch <- errors.New("chunk too short")
+					return
+				}
+
+				err = u.UploadChunk(id, chunk)
+				if err != nil {
+					errch <- err
+					return
+				}
+
+				mutex.Lock()
+				journal.State = u.State()
+				err = journal.save(journalfile)
+				mutex.Unlock()
+				if err != nil {
+					errch <- err
+					return
+				}
+
+				report(chk_size)
+			}
+		}()
+	}
+
+	var err error
+	for id := 0; id < u.Chunks() && err == nil; {
+		if state.ChunkMacs[id] != nil {
+			id++
+			continue
+		}
+
+		select {
+		case workch <- id:
+			id++
+		case err = <-errch:
+		}
+	}
+	close(workch)
+
+	wg.Wait()
+
+	if err == nil {
+		select {
+		case err = <-errch:
+		default:
+		}
+	}
+
+	if sent < shown {
+		return shown, err
+	}
+
+	return sent, err
+}
@@ -0,0 +1,119 @@
+package megaclient
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/t3rm1n4l/go-mega"
+)
+
+const (
+	SESSIONS_DIR = "sessions"
+)
+
+// Session of a login which is cached to skip the password login
+type session struct {
+	User string
+	Sid  []byte
+	Key  []byte
+}
+
+// Get the session file of the configured user
+func (mc *MegaClient) sessionPath() string {
+	h := sha1.Sum([]byte(mc.cfg.User))
+	return filepath.Join(mc.cfg.StateDir, SESSIONS_DIR, hex.EncodeToString(h[:]))
+}
+
+func (mc *MegaClient) loadSession() (*session, error) {
+	data, err := ioutil.ReadFile(mc.sessionPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var s session
+	err = json.Unmarshal(data, &s)
+	if err != nil || s.User != mc.cfg.User {
+		return nil, ESESSION
+	}
+
+	return &s, nil
+}
+
+// Save the session for the following commands
+//
+// The session file isn't encrypted, anyone who can read it can use the
+// account until logout. It is protected by its 0600 file mode only.
+func (mc *MegaClient) saveSession() error {
+	s := session{
+		User: mc.cfg.User,
+		Sid:  mc.mega.SessionID(),
+		Key:  mc.mega.MasterKey(),
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(mc.sessionPath()), 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(mc.sessionPath(), data, 0600)
+}
+
+func (mc *MegaClient) removeSession() error {
+	err := os.Remove(mc.sessionPath())
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	return err
+}
+
+// Log in with the password and cache the session, so the following
+// commands resume it instead
+func (mc *MegaClient) NewSession() error {
+	err := mc.user()
+	if err != nil {
+		return err
+	}
+
+	err = mc.passwordLogin()
+	if err != nil {
+		return err
+	}
+
+	return mc.saveSession()
+}
+
+// End the cached session on the server and remove it
+func (mc *MegaClient) Logout() error {
+	err := mc.user()
+	if err != nil {
+		return err
+	}
+
+	s, err := mc.loadSession()
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return mc.removeSession()
+	}
+
+	err = mc.mega.ResumeSession(s.Sid, s.Key)
+	if err == nil {
+		err = mc.mega.Logout()
+	}
+	if err != nil && err != mega.ESID {
+		return err
+	}
+
+	return mc.removeSession()
+}
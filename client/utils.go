@@ -14,6 +14,22 @@ import (
 	"github.com/t3rm1n4l/go-mega"
 )
 
+// Check whether the resource is a public link instead of a mega path
+func IsPublicLink(resource string) bool {
+	return strings.HasPrefix(resource, "https://") || strings.HasPrefix(resource, "http://")
+}
+
+// Check whether a name given by someone else can be used as a local
+// file name without leaving the directory it is saved in
+func isSafeName(name string) bool {
+	switch name {
+	case "", ".", "..":
+		return false
+	}
+
+	return !strings.ContainsAny(name, "/\\")
+}
+
 // Get all the paths by doing DFS traversal
 func getRemotePaths(fs *mega.MegaFS, n *mega.Node, recursive bool) []Path {
 	paths := []Path{}
@@ -42,7 +58,8 @@ func getRemotePaths(fs *mega.MegaFS, n *mega.Node, recursive bool) []Path {
 			copy(p.path, pathstack)
 			p.t = nodestack[index].GetType()
 			p.size = nodestack[index].GetSize()
-			p.ts = nodestack[index].GetTimeStamp()
+			p.ts = nodestack[index].GetModTime()
+			p.hash = nodestack[index].GetHash()
 			paths = append(paths, p)
 
 			pathstack = pathstack[:len(pathstack)-1]
@@ -55,8 +72,17 @@ func getRemotePaths(fs *mega.MegaFS, n *mega.Node, recursive bool) []Path {
 	return paths
 }
 
-func getLocalPaths(root string, skiperror bool) ([]Path, error) {
+// Get all the paths under root which are not left out by the filter
+func getLocalPaths(root string, skiperror bool, f *filter) ([]Path, error) {
+	paths, _, err := walkLocalPaths(root, skiperror, f)
+	return paths, err
+}
+
+// Get all the paths under root which are not left out by the filter,
+// along with the paths which could not be read and were skipped
+func walkLocalPaths(root string, skiperror bool, f *filter) ([]Path, []string, error) {
 	var paths []Path
+	var skipped []string
 
 	walker := func(p string, info os.FileInfo, err error) error {
 		var x Path
@@ -64,6 +90,7 @@ func getLocalPaths(root string, skiperror bool) ([]Path, error) {
 
 		if err != nil {
 			if skiperror {
+				skipped = append(skipped, filepath.ToSlash(p))
 				return nil
 			} else {
 				return err
@@ -85,7 +112,15 @@ func getLocalPaths(root string, skiperror bool) ([]Path, error) {
 			return nil
 		}
 
+		if f.skip(x) {
+			if x.t == mega.FOLDER {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		x.size = info.Size()
+		x.ts = info.ModTime()
 		paths = append(paths, x)
 
 		return nil
@@ -93,7 +128,75 @@ func getLocalPaths(root string, skiperror bool) ([]Path, error) {
 
 	err := filepath.Walk(root, walker)
 
-	return paths, err
+	return paths, skipped, err
+}
+
+// Check whether a path relative to the sync root is one of the skipped
+// paths or is under one of them
+func isSkippedPath(p string, skipped []string) bool {
+	p = strings.TrimSuffix(p, "/")
+	for _, s := range skipped {
+		if p == s || strings.HasPrefix(p, s+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Get the folder named name which is shared with us by owner
+func getSharedRoot(fs *mega.MegaFS, owner, name string) *mega.Node {
+	for _, n := range fs.GetSharedRoots() {
+		if n.GetOwner() == owner && n.GetName() == name {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// Get the entries of the shared:/ and shared:/owner/ levels, which
+// list the owners and the folders they share
+func getSharedIndex(resource string, fs *mega.MegaFS) ([]Path, bool) {
+	resource = strings.TrimSpace(resource)
+	if !strings.HasPrefix(resource, SHARED+":/") {
+		return nil, false
+	}
+
+	var names []string
+	for _, s := range strings.Split(resource[len(SHARED)+2:], "/") {
+		if s != "" {
+			names = append(names, s)
+		}
+	}
+
+	if len(names) > 1 {
+		return nil, false
+	}
+
+	var paths []Path
+	if len(names) == 1 && !strings.HasSuffix(resource, "/") {
+		paths = append(paths, Path{prefix: resource, t: mega.FOLDER})
+		return paths, true
+	}
+
+	seen := make(map[string]bool)
+	for _, n := range fs.GetSharedRoots() {
+		owner := n.GetOwner()
+		switch {
+		case len(names) == 0 && !seen[owner]:
+			seen[owner] = true
+			paths = append(paths, Path{prefix: SHARED + ":/" + owner, t: mega.FOLDER})
+		case len(names) == 1 && owner == names[0]:
+			paths = append(paths, Path{
+				prefix: SHARED + ":/" + owner + "/" + n.GetName(),
+				t:      mega.FOLDER,
+				ts:     n.GetModTime(),
+			})
+		}
+	}
+
+	return paths, true
 }
 
 func getLookupParams(resource string, fs *mega.MegaFS) (*mega.Node, *[]string, error) {
@@ -111,6 +214,9 @@ func getLookupParams(resource string, fs *mega.MegaFS) (*mega.Node, *[]string, e
 		root = fs.GetRoot()
 	case args[0] == TRASH:
 		root = fs.GetTrash()
+	case args[0] == INBOX:
+		root = fs.GetInbox()
+	case args[0] == SHARED:
 	default:
 		return nil, nil, EINVALID_PATH
 	}
@@ -132,9 +238,41 @@ func getLookupParams(resource string, fs *mega.MegaFS) (*mega.Node, *[]string, e
 		}
 	}
 
+	// Shared folders are addressed by the owner email and folder name
+	if args[0] == SHARED {
+		if len(pathsplit) < 2 {
+			return nil, nil, EINVALID_PATH
+		}
+
+		root = getSharedRoot(fs, pathsplit[0], pathsplit[1])
+		if root == nil {
+			return nil, nil, mega.ENOENT
+		}
+		pathsplit = pathsplit[2:]
+	}
+
 	return root, &pathsplit, err
 }
 
+// Get the node located at the given mega path
+func lookupNode(resource string, fs *mega.MegaFS) (*mega.Node, error) {
+	root, pathsplit, err := getLookupParams(resource, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(*pathsplit) == 0 {
+		return root, nil
+	}
+
+	nodes, err := fs.PathLookup(root, *pathsplit)
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes[len(nodes)-1], nil
+}
+
 func RoundDuration(d time.Duration) time.Duration {
 	return time.Second * time.Duration(int(d.Seconds()))
 }
@@ -194,3 +332,106 @@ func progressBar(ch chan int, wg *sync.WaitGroup, size int64, src, dst string) {
 		showProgress()
 	}
 }
+
+// Combined progress of several concurrent transfers
+type transferProgress struct {
+	mutex    sync.Mutex
+	files    int
+	done     int
+	size     int64
+	finished int64
+	active   int64
+	start    time.Time
+	quit     chan bool
+	wg       sync.WaitGroup
+}
+
+func newTransferProgress(files int, size int64) *transferProgress {
+	p := &transferProgress{
+		files: files,
+		size:  size,
+		start: time.Now(),
+		quit:  make(chan bool),
+	}
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Get a progress channel for one transfer, the bytes sent on it are
+// added to the combined progress until it is closed
+func (p *transferProgress) track(wg *sync.WaitGroup) *chan int {
+	ch := make(chan int)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		var n int64
+		for b := range ch {
+			n += int64(b)
+			p.mutex.Lock()
+			p.active += int64(b)
+			p.mutex.Unlock()
+		}
+
+		p.mutex.Lock()
+		p.active -= n
+		p.mutex.Unlock()
+	}()
+
+	return &ch
+}
+
+// Account for a file which was either transferred or skipped
+func (p *transferProgress) fileDone(size int64) {
+	p.mutex.Lock()
+	p.done++
+	p.finished += size
+	p.mutex.Unlock()
+}
+
+func (p *transferProgress) show() {
+	p.mutex.Lock()
+	done, copied := p.done, p.finished+p.active
+	p.mutex.Unlock()
+
+	percent := float32(100)
+	if p.size > 0 {
+		percent = 100 * float32(copied) / float32(p.size)
+	}
+
+	elapsed := time.Now().Sub(p.start)
+	bps := uint64(float64(copied) / elapsed.Seconds())
+
+	if runtime.GOOS == "windows" {
+		fmt.Printf("\r%s\r", bytes.Repeat([]byte{0x20}, 79))
+	} else {
+		fmt.Printf("\r\033[2K")
+	}
+	fmt.Printf("Copied %d of %d file(s) # %.2f %% of %s at %.4s/s %v ", done, p.files, percent,
+		humanize.Bytes(uint64(p.size)), humanize.Bytes(bps), RoundDuration(elapsed))
+}
+
+func (p *transferProgress) run() {
+	defer p.wg.Done()
+
+	for {
+		p.show()
+
+		select {
+		case <-p.quit:
+			p.show()
+			fmt.Println()
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (p *transferProgress) stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net"
+	"os"
+
+	"github.com/t3rm1n4l/go-mega"
+	"github.com/t3rm1n4l/megacmd/client"
+)
+
+// Exit codes of the error classes
+//
+// These are part of the command line interface, so scripts can rely on
+// them. Don't renumber them.
+const (
+	EXIT_OK        = 0
+	EXIT_ERROR     = 1 // Any error not covered by the codes below
+	EXIT_USAGE     = 2 // Invalid command, option or config
+	EXIT_PATH      = 3 // Invalid source or destination path
+	EXIT_NOT_FOUND = 4 // File or folder not found
+	EXIT_EXISTS    = 5 // File or folder already exists
+	EXIT_AUTH      = 6 // Login failed or access denied
+	EXIT_QUOTA     = 7 // Not enough storage or transfer quota
+	EXIT_NETWORK   = 8 // Mega service can't be reached or is unavailable
+	EXIT_INTEGRITY = 9 // Downloaded data doesn't match its MAC
+)
+
+var exitCodes = []struct {
+	code   int
+	errors []error
+}{
+	{EXIT_USAGE, []error{
+		megaclient.EINVALID_CONFIG,
+		megaclient.EINVALID_SYNC,
+		megaclient.EINVALID_MODE,
+		megaclient.EINVALID_FILTER,
+		megaclient.EINVALID_ACCESS,
+		megaclient.EINVALID_SORT,
+		megaclient.EINVALID_OUTPUT,
+		megaclient.EINVALID_PROFILE,
+		mega.EWORKER_LIMIT_EXCEEDED,
+	}},
+	{EXIT_PATH, []error{
+		megaclient.EINVALID_PATH,
+		megaclient.EINVALID_DEST,
+		megaclient.EINVALID_SRC,
+		megaclient.ENOT_FILE,
+		megaclient.ENOT_DIRECTORY,
+		megaclient.EINVALID_USER,
+		megaclient.EINVALID_NAME,
+		mega.EBADLINK,
+	}},
+	{EXIT_NOT_FOUND, []error{
+		mega.ENOENT,
+	}},
+	{EXIT_EXISTS, []error{
+		megaclient.EFILE_EXISTS,
+		megaclient.EDIR_EXISTS,
+		mega.EEXIST,
+	}},
+	{EXIT_AUTH, []error{
+		megaclient.ECREDENTIALS,
+		megaclient.EPASSWORD_COMMAND,
+		mega.EACCESS,
+		mega.ESID,
+		mega.EBLOCKED,
+	}},
+	{EXIT_QUOTA, []error{
+		megaclient.EQUOTA,
+		mega.EOVERQUOTA,
+	}},
+	{EXIT_NETWORK, []error{
+		mega.EAGAIN,
+		mega.ERATELIMIT,
+		mega.ETEMPUNAVAIL,
+		mega.EBADRESP,
+	}},
+	{EXIT_INTEGRITY, []error{
+		mega.EMACMISMATCH,
+		mega.EKEY,
+	}},
+}
+
+// Get the exit code of the class of an error
+//
+// Errors returned with details of the path are classified by the error
+// they wrap.
+func exitCode(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+
+	err = megaclient.ErrorCause(err)
+	for _, c := range exitCodes {
+		for _, e := range c.errors {
+			if err == e {
+				return c.code
+			}
+		}
+	}
+
+	switch err.(type) {
+	case net.Error:
+		return EXIT_NETWORK
+	}
+
+	switch {
+	case os.IsNotExist(err):
+		return EXIT_NOT_FOUND
+	case os.IsExist(err):
+		return EXIT_EXISTS
+	case os.IsPermission(err):
+		return EXIT_AUTH
+	}
+
+	return EXIT_ERROR
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -22,30 +23,78 @@ var (
 
 const (
 	CONFIG_FILE = ".megacmd.json"
+	STATE_DIR   = ".megacmd"
 	AUTHOR      = "Sarath Lakshman"
 	URL         = "github.com/t3rm1n4l/megacmd"
 )
 
+// Flag which can be given more than once
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
 const USAGE = `
 	megacmd [OPTIONS] list mega:/foo/bar
 	megacmd [OPTIONS] get mega:/foo/file.txt /tmp/
+	megacmd [OPTIONS] get https://mega.co.nz/#!id!key /tmp/
 	megacmd [OPTIONS] put /tmp/hello.txt mega:/bar/
+	megacmd [OPTIONS] -recursive get mega:/foo/dir /tmp/
+	megacmd [OPTIONS] -recursive put /tmp/dir mega:/bar/
 	megacmd [OPTIONS] delete mega:/foo/bar
 	megacmd [OPTIONS] mkdir mega:/foo/bar
 	megacmd [OPTIONS] move mega:/foo/file.txt mega:/bar/foo.txt
+	megacmd [OPTIONS] copy mega:/foo mega:/bar/
 	megacmd [OPTIONS] sync mega:/foo/ /tmp/foo/
 	megacmd [OPTIONS] sync /tmp/foo mega:/foo
+	megacmd [OPTIONS] sync mega:/foo backup@mega:/foo
+	megacmd [OPTIONS] -delete sync /tmp/foo mega:/foo
+	megacmd [OPTIONS] -dry-run sync /tmp/foo mega:/foo
+	megacmd [OPTIONS] -exclude node_modules/ -exclude '*.tmp' sync /tmp/foo mega:/foo
+	megacmd [OPTIONS] bisync /tmp/foo mega:/foo
+	megacmd [OPTIONS] link mega:/foo/file.txt
+	megacmd [OPTIONS] -recursive -no-key link mega:/foo/bar
+	megacmd [OPTIONS] import https://mega.co.nz/#!id!key mega:/foo/
+	megacmd [OPTIONS] -access readwrite share mega:/foo user@example.com
+	megacmd [OPTIONS] unshare mega:/foo user@example.com
+	megacmd [OPTIONS] shares
+	megacmd [OPTIONS] whoami
+	megacmd [OPTIONS] -output json df
+	megacmd [OPTIONS] -recursive -output csv list mega:/foo/
+	megacmd [OPTIONS] -depth 1 -sort size -human du mega:/foo/
+	megacmd [OPTIONS] shell [mega:/foo]
+	megacmd [OPTIONS] login
+	megacmd [OPTIONS] logout
 
 `
 
 const (
-	LIST   = "list"
-	GET    = "get"
-	PUT    = "put"
-	DELETE = "delete"
-	MKDIR  = "mkdir"
-	MOVE   = "move"
-	SYNC   = "sync"
+	LIST    = "list"
+	GET     = "get"
+	PUT     = "put"
+	DELETE  = "delete"
+	MKDIR   = "mkdir"
+	MOVE    = "move"
+	COPY    = "copy"
+	SYNC    = "sync"
+	BISYNC  = "bisync"
+	LINK    = "link"
+	IMPORT  = "import"
+	SHARE   = "share"
+	UNSHARE = "unshare"
+	SHARES  = "shares"
+	WHOAMI  = "whoami"
+	DF      = "df"
+	DU      = "du"
+	SHELL   = "shell"
+	LOGIN   = "login"
+	LOGOUT  = "logout"
 )
 
 func main() {
@@ -55,12 +104,34 @@ func main() {
 		showVersion = flag.Bool("version", false, "Version")
 		verbose     = flag.Int("verbose", 1, "Verbose")
 		config      = flag.String("conf", path.Join(usr.HomeDir, CONFIG_FILE), "Config file path")
-		recursive   = flag.Bool("recursive", false, "Recursive listing")
+		profile     = flag.String("profile", "", "Use the settings of a profile of the config file")
+		recursive   = flag.Bool("recursive", false, "Recursive listing, get and put")
 		force       = flag.Bool("force", false, "Force hard delete or overwrite")
 		skipsize    = flag.Bool("skip-same-size", false, "Skip copying of files with same size and path suffix")
+		compare     = flag.String("compare", "", "Skip copying of unchanged files compared by size, size+mtime or checksum")
 		skiperror   = flag.Bool("skip-error", false, "Skip syncing of files that can't be read")
+		syncdelete  = flag.Bool("delete", false, "Delete files at sync destination which are not present at source")
+		dryrun      = flag.Bool("dry-run", false, "Show the actions to be performed without changing anything")
+		resume      = flag.Bool("resume", false, "Resume interrupted downloads and uploads")
+		cache       = flag.Bool("cache", false, "Cache the filesystem to fetch only the changes on the next run")
+		transfers   = flag.Int("transfers", 0, "Number of files to copy in parallel by sync and recursive get and put")
+		excludefrom = flag.String("exclude-from", "", "Read exclude patterns from a file")
+		nokey       = flag.Bool("no-key", false, "Export links without the decryption key")
+		printkey    = flag.Bool("print-key", false, "Export links without the decryption key and print the key separately")
+		depth       = flag.Int("depth", -1, "Show du of folders up to this many levels below the path (-1 for all)")
+		sortby      = flag.String("sort", megaclient.SORT_PATH, "Sort du output by path or size")
+		human       = flag.Bool("human", false, "Show du sizes in human readable units")
+		checkusage  = flag.Bool("check-usage", false, "Compare du totals with the usage accounted by the server")
+		output      = flag.String("output", megaclient.OUTPUT_TEXT, "Output format: text, json, jsonl, csv or tsv")
+		jsonout     = flag.Bool("json", false, "Print whoami and df output as json")
+		access      = flag.String("access", megaclient.ACCESS_READ, "Access level of a share: read, readwrite or full")
+		include     listFlag
+		exclude     listFlag
 	)
 
+	flag.Var(&include, "include", "Copy and list paths matching the pattern even if excluded (can be repeated)")
+	flag.Var(&exclude, "exclude", "Skip paths matching the pattern in sync, list and recursive get and put (can be repeated)")
+
 	log.SetFlags(0)
 
 	var Usage = func() {
@@ -81,15 +152,97 @@ func main() {
 		os.Exit(0)
 	}
 
-	if flag.NArg() < 2 || *help {
+	// Commands which don't take a path
+	noargs := map[string]bool{
+		SHARES: true,
+		WHOAMI: true,
+		DF:     true,
+		SHELL:  true,
+		LOGIN:  true,
+		LOGOUT: true,
+	}
+
+	if flag.NArg() < 1 || (flag.NArg() < 2 && !noargs[flag.Arg(0)]) || *help {
 		Usage()
-		os.Exit(1)
+		os.Exit(EXIT_USAGE)
+	}
+
+	cmd := flag.Arg(0)
+	arg1 := flag.Arg(1)
+	arg2 := ""
+	if flag.NArg() > 2 {
+		arg2 = flag.Arg(2)
+	}
+
+	// Remote paths can be in the account of another profile, like
+	// backup@mega:/foo
+	p1, arg1 := megaclient.SplitProfile(arg1)
+	p2, arg2 := megaclient.SplitProfile(arg2)
+	if p1 == *profile {
+		p1 = ""
+	}
+	if p2 == *profile {
+		p2 = ""
+	}
+
+	// Records are written to stdout in the structured formats, while
+	// the text format keeps logging to stderr
+	var out *megaclient.OutputWriter
+	if *output != megaclient.OUTPUT_TEXT {
+		var err error
+		out, err = megaclient.NewOutputWriter(*output, os.Stdout)
+		if err != nil {
+			log.Print(err)
+			os.Exit(EXIT_USAGE)
+		}
+	}
+
+	emit := func(r megaclient.Record) {
+		err := out.Write(r)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
+	fatal := func(code int, format string, v ...interface{}) {
+		msg := fmt.Sprintf(format, v...)
+		if out == nil {
+			log.Print("ERROR: " + msg)
+			os.Exit(code)
+		}
+
+		emit(megaclient.Result{
+			Command:     cmd,
+			Source:      arg1,
+			Destination: arg2,
+			Status:      megaclient.STATUS_ERROR,
+			Message:     msg,
+		})
+		_ = out.Close()
+		os.Exit(code)
+	}
+
+	// Public links are downloaded without logging in, so the config
+	// file is optional. So it is when the user is given in the
+	// environment.
+	public := cmd == GET && megaclient.IsPublicLink(arg1)
+	optional := public || os.Getenv(megaclient.ENV_USER) != ""
+
 	conf := new(megaclient.Config)
 	err := conf.Parse(*config)
-	if err != nil {
-		log.Fatal(err)
+	if err != nil && !(optional && os.IsNotExist(err)) {
+		fatal(exitCode(err), "%s", err)
+	}
+
+	if *profile != "" {
+		err = conf.SelectProfile(*profile)
+		if err != nil {
+			fatal(exitCode(err), "%s", err)
+		}
+	}
+
+	if conf.StateDir == "" {
+		conf.StateDir = path.Join(usr.HomeDir, STATE_DIR)
 	}
 
 	if *recursive {
@@ -108,69 +261,189 @@ func main() {
 		conf.SkipSameSize = true
 	}
 
+	if *compare != "" {
+		conf.Compare = *compare
+	}
+
 	if *skiperror {
 		conf.SkipError = true
 	}
 
+	if *syncdelete {
+		conf.Delete = true
+	}
+
+	if *dryrun {
+		conf.DryRun = true
+	}
+
+	if *resume {
+		conf.Resume = true
+	}
+
+	if *cache {
+		conf.Cache = true
+	}
+
+	if *transfers != 0 {
+		conf.Transfers = *transfers
+	}
+
+	if len(include) > 0 {
+		conf.Include = include
+	}
+
+	if len(exclude) > 0 {
+		conf.Exclude = exclude
+	}
+
+	if *excludefrom != "" {
+		conf.ExcludeFrom = *excludefrom
+	}
+
+	// Progress lines would get mixed up with the records
+	if out != nil {
+		conf.Verbose = 0
+	}
+
 	go func() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt)
 		<-c
-		fmt.Printf("\033[2K\rQuit!\n")
+		if conf.Resume {
+			fmt.Printf("\033[2K\rQuit! Run again with -resume to continue\n")
+		} else {
+			fmt.Printf("\033[2K\rQuit!\n")
+		}
 		os.Exit(1)
 	}()
 
-	client, err := megaclient.NewMegaClient(conf)
-	if err != nil {
-		log.Fatal(err)
+	loginFailed := func(err error) {
+		switch code := exitCode(err); {
+		case err == mega.ENOENT:
+			fatal(EXIT_AUTH, "Login failed, Please verify username or password")
+		case code == EXIT_AUTH:
+			fatal(EXIT_AUTH, "Login failed (%s)", err)
+		default:
+			fatal(EXIT_NETWORK, "Unable to establish connection to mega service")
+		}
 	}
 
-	err = client.Login()
-	if err != nil {
-		if err == mega.ENOENT {
-			log.Fatal("Login failed, Please verify username or password")
-		} else {
-			log.Fatal("Unable to establish connection to mega service")
+	// Clients of the accounts of the profiles, the selected one is
+	// named by the empty string
+	clients := make(map[string]*megaclient.MegaClient)
+	clientFor := func(name string) *megaclient.MegaClient {
+		if c, ok := clients[name]; ok {
+			return c
+		}
+
+		cfg := conf
+		if name != "" {
+			cfg, err = conf.ForProfile(name)
+			if err != nil {
+				fatal(exitCode(err), "%s", err)
+			}
+		}
+
+		c, err := megaclient.NewMegaClient(cfg)
+		if err != nil {
+			fatal(exitCode(err), "%s", err)
+		}
+		if out != nil {
+			c.SetOutput(out)
+		}
+		c.SetPrompt(prompt)
+
+		// Login and logout commands handle the session themselves
+		if !public && cmd != LOGIN && cmd != LOGOUT {
+			err = c.Login()
+			if err != nil {
+				loginFailed(err)
+			}
 		}
+
+		clients[name] = c
+		return c
 	}
 
-	cmd := flag.Arg(0)
-	arg1 := flag.Arg(1)
-	arg2 := ""
-	if flag.NArg() > 2 {
-		arg2 = flag.Arg(2)
+	// Only sync copies between the accounts of two profiles
+	cross := megaclient.IsRemotePath(arg1) && megaclient.IsRemotePath(arg2) && p1 != p2
+	if cross && cmd != SYNC {
+		fatal(EXIT_PATH, "%s : %s and %s are in different accounts", megaclient.EINVALID_PATH, arg1, arg2)
+	}
+
+	name := p1
+	if name == "" && !cross {
+		name = p2
+	}
+	client := clientFor(name)
+
+	success := func(format string, v ...interface{}) {
+		switch {
+		case out != nil:
+			status := megaclient.STATUS_OK
+			if conf.DryRun {
+				status = megaclient.STATUS_DRYRUN
+			}
+			emit(megaclient.Result{
+				Command:     cmd,
+				Source:      arg1,
+				Destination: arg2,
+				Status:      status,
+				Message:     strings.TrimSpace(fmt.Sprintf(format, v...)),
+			})
+		case !conf.DryRun:
+			// Nothing is changed in dry run mode, so don't claim success
+			log.Printf(format, v...)
+		}
 	}
 
 	switch {
 	case cmd == LIST:
 		paths, err := client.List(arg1)
 		if err != nil && err != mega.ENOENT {
-			log.Fatalf("ERROR: List failed (%s)", err)
+			fatal(exitCode(err), "List failed (%s)", err)
 		}
 		if err == nil {
 			for _, p := range *paths {
-				log.Println(p)
+				if out != nil {
+					emit(p.Record())
+				} else {
+					log.Println(p)
+				}
 			}
 		}
 	case cmd == DELETE:
 		err := client.Delete(arg1)
 		if err != nil {
-			log.Fatalf("ERROR: Unable to delete %s (%s)", arg1, err)
+			fatal(exitCode(err), "Unable to delete %s (%s)", arg1, err)
 		}
-		log.Println("Successfully deleted ", arg1)
+		success("Successfully deleted %s", arg1)
 
 	case cmd == MOVE:
 		err := client.Move(arg1, arg2)
 		if err != nil {
-			log.Fatalf("ERROR: Unable to move %s (%s)", arg1, err)
+			fatal(exitCode(err), "Unable to move %s (%s)", arg1, err)
+		}
+
+		success("Successfully moved %s to %s\n", arg1, arg2)
+
+	case cmd == COPY:
+		err := client.Copy(arg1, arg2)
+		if err != nil {
+			fatal(exitCode(err), "Unable to copy %s (%s)", arg1, err)
 		}
 
-		log.Printf("Successfully moved %s to %s\n", arg1, arg2)
+		success("Successfully copied %s to %s", arg1, arg2)
 
 	case cmd == GET:
 
-		if arg2 == "" {
-			name := strings.Split(arg1, "/")
+		switch {
+		case arg2 != "":
+		case public:
+			arg2 = "./"
+		default:
+			name := strings.Split(strings.TrimSuffix(arg1, "/"), "/")
 			if len(name) > 0 {
 				arg2 = name[len(name)-1]
 			}
@@ -179,41 +452,239 @@ func main() {
 		x := time.Now()
 		err := client.Get(arg1, arg2)
 		if err != nil {
-			log.Fatalf("ERROR: Downloading %s to %s failed (%s)", arg1, arg2, err)
+			fatal(exitCode(err), "Downloading %s to %s failed (%s)", arg1, arg2, err)
 		}
 		dur := megaclient.RoundDuration(time.Now().Sub(x))
-		log.Printf("Successfully downloaded file %s to %s in %v", arg1, arg2, dur)
+		success("Successfully downloaded file %s to %s in %v", arg1, arg2, dur)
 
 	case cmd == PUT:
 		x := time.Now()
 		err := client.Put(arg1, arg2)
 		if err != nil {
-			log.Fatalf("ERROR: Uploading %s to %s failed (%s)", arg1, arg2, err)
+			fatal(exitCode(err), "Uploading %s to %s failed (%s)", arg1, arg2, err)
 		}
 
 		dur := megaclient.RoundDuration(time.Now().Sub(x))
-		log.Printf("Successfully uploaded file %s to %s in %s", arg1, arg2, dur)
+		success("Successfully uploaded file %s to %s in %s", arg1, arg2, dur)
 
 	case cmd == MKDIR:
 		err := client.Mkdir(arg1)
 		if err != nil {
-			log.Fatalf("ERROR: Unable to create directory %s (%s)", arg1, err)
+			fatal(exitCode(err), "Unable to create directory %s (%s)", arg1, err)
 		}
 
-		log.Printf("Successfully created directory at %s", arg1)
+		success("Successfully created directory at %s", arg1)
 
 	case cmd == SYNC:
 		x := time.Now()
-		err := client.Sync(arg1, arg2)
+		var err error
+		if cross {
+			err = client.SyncTo(clientFor(p2), arg1, arg2)
+		} else {
+			err = client.Sync(arg1, arg2)
+		}
+		if err != nil {
+			fatal(exitCode(err), "Unable to sync %s to %s (%s)", arg1, arg2, err)
+		}
+
+		dur := megaclient.RoundDuration(time.Now().Sub(x))
+		success("Successfully sync %s to %s in %s", arg1, arg2, dur)
+
+	case cmd == BISYNC:
+		x := time.Now()
+		err := client.BiSync(arg1, arg2)
 		if err != nil {
-			log.Fatalf("ERROR: Unable to sync %s to %s (%s)", arg1, arg2, err)
+			fatal(exitCode(err), "Unable to sync %s and %s (%s)", arg1, arg2, err)
 		}
 
 		dur := megaclient.RoundDuration(time.Now().Sub(x))
-		log.Printf("Successfully sync %s to %s in %s", arg1, arg2, dur)
+		success("Successfully sync %s and %s in %s", arg1, arg2, dur)
+
+	case cmd == LINK:
+		links, err := client.Link(arg1)
+		if err != nil {
+			fatal(exitCode(err), "Unable to export link for %s (%s)", arg1, err)
+		}
+
+		for _, l := range links {
+			url := l.Link(!*nokey && !*printkey)
+			switch {
+			case out != nil:
+				r := megaclient.PublicLink{Path: l.Path, Url: url}
+				if *printkey {
+					r.Key = l.Key
+				}
+				emit(r)
+			case conf.Recursive && *printkey:
+				fmt.Printf("%s\t%s\t%s\n", l.Path, url, l.Key)
+			case conf.Recursive:
+				fmt.Printf("%s\t%s\n", l.Path, url)
+			case *printkey:
+				fmt.Println(url)
+				fmt.Println(l.Key)
+			default:
+				fmt.Println(url)
+			}
+		}
+
+	case cmd == IMPORT:
+		if arg2 == "" {
+			arg2 = "mega:/"
+		}
+
+		err := client.Import(arg1, arg2)
+		if err != nil {
+			fatal(exitCode(err), "Unable to import %s to %s (%s)", arg1, arg2, err)
+		}
+
+		success("Successfully imported %s to %s", arg1, arg2)
+
+	case cmd == SHARE:
+		err := client.Share(arg1, arg2, *access)
+		if err != nil {
+			fatal(exitCode(err), "Unable to share %s with %s (%s)", arg1, arg2, err)
+		}
+
+		success("Successfully shared %s with %s", arg1, arg2)
+
+	case cmd == UNSHARE:
+		err := client.Unshare(arg1, arg2)
+		if err != nil {
+			fatal(exitCode(err), "Unable to unshare %s with %s (%s)", arg1, arg2, err)
+		}
+
+		success("Successfully unshared %s with %s", arg1, arg2)
+
+	case cmd == SHARES:
+		shares, err := client.Shares()
+		if err != nil {
+			fatal(exitCode(err), "Unable to list shares (%s)", err)
+		}
+
+		for _, s := range shares {
+			if out != nil {
+				emit(s)
+			} else {
+				log.Println(s)
+			}
+		}
+
+	case cmd == WHOAMI:
+		account, err := client.WhoAmI()
+		if err != nil {
+			fatal(exitCode(err), "Unable to get account details (%s)", err)
+		}
+
+		if out != nil {
+			emit(account)
+		} else {
+			printResult(account, *jsonout)
+		}
+
+	case cmd == DF:
+		quota, err := client.Quota()
+		if err != nil {
+			fatal(exitCode(err), "Unable to get storage quota (%s)", err)
+		}
+
+		if out != nil {
+			emit(quota)
+		} else {
+			printResult(quota, *jsonout)
+		}
+
+	case cmd == DU:
+		usage, err := client.DiskUsage(arg1, *depth, *sortby)
+		if err != nil {
+			fatal(exitCode(err), "Unable to get disk usage of %s (%s)", arg1, err)
+		}
+
+		for _, u := range usage {
+			if out != nil {
+				emit(u)
+			} else {
+				fmt.Println(u.Format(*human))
+			}
+		}
+
+		if *checkusage {
+			server, err := client.ServerUsage(arg1)
+			switch {
+			case err != nil:
+				fatal(exitCode(err), "Unable to get usage of %s from server (%s)", arg1, err)
+			case server == nil:
+				log.Printf("Server doesn't account usage of %s, only of top level folders", arg1)
+			default:
+				var total megaclient.Usage
+				for _, u := range usage {
+					if u.Path == arg1 {
+						total = u
+					}
+				}
+
+				if total.Size != server.Size || total.Files != server.Files || total.Folders != server.Folders {
+					fatal(EXIT_ERROR, "Usage mismatch, server accounts %d bytes in %d file(s) and %d folder(s), found %d bytes in %d file(s) and %d folder(s)",
+						server.Size, server.Files, server.Folders, total.Size, total.Files, total.Folders)
+				}
+				success("Usage matches the server accounting")
+			}
+		}
+
+	case cmd == SHELL:
+		s := newShell(client)
+		if arg1 != "" {
+			err := s.cd([]string{arg1})
+			if err != nil {
+				fatal(exitCode(err), "Unable to change to %s (%s)", arg1, err)
+			}
+		}
+
+		err = s.Run()
+		if err != nil {
+			if out != nil {
+				_ = out.Close()
+			}
+			os.Exit(exitCode(err))
+		}
+
+	case cmd == LOGIN:
+		err := client.NewSession()
+		if err != nil {
+			loginFailed(err)
+		}
+
+		success("Successfully logged in as %s", conf.User)
+
+	case cmd == LOGOUT:
+		err := client.Logout()
+		if err != nil {
+			fatal(exitCode(err), "Unable to log out (%s)", err)
+		}
+
+		success("Successfully logged out")
 
 	default:
-		log.Fatal("Invalid command")
+		fatal(EXIT_USAGE, "Invalid command")
 	}
 
+	if out != nil {
+		err = out.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Print the result of a command as text or json
+func printResult(v fmt.Stringer, asjson bool) {
+	if !asjson {
+		fmt.Println(v)
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
 }
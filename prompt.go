@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Ask for a value on the terminal, without echoing it when it is secret
+//
+// The terminal is used even when the input is redirected, e.g. when the
+// commands of a shell are piped.
+func prompt(text string, secret bool) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tty.Close()
+	}()
+
+	if secret {
+		state, err := stty(tty, "-g")
+		if err != nil {
+			return "", err
+		}
+		_, err = stty(tty, "-echo")
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_, _ = stty(tty, state)
+			_, _ = fmt.Fprintln(tty)
+		}()
+	}
+
+	_, err = fmt.Fprint(tty, text)
+	if err != nil {
+		return "", err
+	}
+
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
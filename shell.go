@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/t3rm1n4l/megacmd/client"
+)
+
+const (
+	SHELL_HOME    = "mega:/"
+	SHELL_HISTORY = 500
+)
+
+var (
+	EUNKNOWN_COMMAND = errors.New("Unknown command, try help")
+	ESHELL_USAGE     = errors.New("Invalid arguments")
+)
+
+// Interactive shell which runs commands with one logged in client, so
+// the filesystem is fetched only once
+type shell struct {
+	client  *megaclient.MegaClient
+	cwd     string
+	in      *bufio.Reader
+	tty     bool
+	history []string
+}
+
+type shellCommand struct {
+	usage string
+	help  string
+	min   int
+	max   int
+	local int // Position of the local path argument, 0 if there is none
+	run   func(s *shell, args []string) error
+}
+
+var shellCommands map[string]shellCommand
+
+func init() {
+	shellCommands = map[string]shellCommand{
+		"cd":    {"cd [path]", "Change the working folder, mega:/ by default", 0, 1, 0, (*shell).cd},
+		"pwd":   {"pwd", "Print the working folder", 0, 0, 0, (*shell).pwd},
+		"ls":    {"ls [path]", "List a folder or file", 0, 1, 0, (*shell).ls},
+		"get":   {"get path [local path]", "Download a file or folder", 1, 2, 2, (*shell).get},
+		"put":   {"put local path [path]", "Upload a file or folder", 1, 2, 1, (*shell).put},
+		"rm":    {"rm path", "Delete a file or folder", 1, 1, 0, (*shell).rm},
+		"mv":    {"mv path path", "Move or rename a file or folder", 2, 2, 0, (*shell).mv},
+		"mkdir": {"mkdir path", "Create a folder and its parents", 1, 1, 0, (*shell).mkdir},
+		"help":  {"help", "Show the commands", 0, 0, 0, (*shell).help},
+		"exit":  {"exit", "Leave the shell", 0, 0, 0, (*shell).exit},
+		"quit":  {"quit", "Leave the shell", 0, 0, 0, (*shell).exit},
+	}
+}
+
+func newShell(client *megaclient.MegaClient) *shell {
+	s := &shell{
+		client: client,
+		cwd:    SHELL_HOME,
+		in:     bufio.NewReader(os.Stdin),
+	}
+
+	// Line editing needs a terminal, otherwise the commands are read
+	// line by line, e.g. from a pipe
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		_, err = stty(os.Stdin, "-g")
+		s.tty = err == nil
+	}
+
+	return s
+}
+
+// Read and run commands until exit or end of input
+//
+// The error of the last command which failed is returned, so a script
+// piped to the shell exits with its code.
+func (s *shell) Run() error {
+	var failed error
+	for {
+		line, err := s.readLine(s.cwd + "> ")
+		if err != nil {
+			return failed
+		}
+
+		err = s.exec(line)
+		switch {
+		case err == io.EOF:
+			return failed
+		case err != nil:
+			log.Printf("ERROR: %s", err)
+			failed = err
+		}
+	}
+}
+
+func (s *shell) exec(line string) error {
+	words, _, _ := splitWords([]rune(line))
+	if len(words) == 0 {
+		return nil
+	}
+
+	c, ok := shellCommands[words[0]]
+	if !ok {
+		return EUNKNOWN_COMMAND
+	}
+
+	args := words[1:]
+	if len(args) < c.min || len(args) > c.max {
+		return errors.New(fmt.Sprintf("%s : %s", ESHELL_USAGE, c.usage))
+	}
+
+	return c.run(s, args)
+}
+
+// Resolve a path relative to the working folder
+func (s *shell) resolve(p string) string {
+	if strings.Contains(p, ":/") {
+		return p
+	}
+
+	i := strings.Index(s.cwd, ":/")
+	root, dir := s.cwd[:i+1], s.cwd[i+1:]
+	resolved := root + path.Clean("/"+p)
+	if !strings.HasPrefix(p, "/") {
+		resolved = root + path.Join(dir, p)
+	}
+
+	if strings.HasSuffix(p, "/") && !strings.HasSuffix(resolved, "/") {
+		resolved += "/"
+	}
+
+	return resolved
+}
+
+// Resolve a path, with a / after it if it is a folder
+func (s *shell) resolveDir(p string) string {
+	resolved := s.resolve(p)
+	if strings.HasSuffix(resolved, "/") {
+		return resolved
+	}
+
+	if _, err := s.client.Names(resolved); err == nil {
+		resolved += "/"
+	}
+
+	return resolved
+}
+
+func (s *shell) cd(args []string) error {
+	dir := SHELL_HOME
+	if len(args) > 0 {
+		dir = s.resolve(args[0])
+	}
+
+	_, err := s.client.Names(dir)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasSuffix(dir, ":/") {
+		dir = strings.TrimSuffix(dir, "/")
+	}
+	s.cwd = dir
+
+	return nil
+}
+
+func (s *shell) pwd(args []string) error {
+	fmt.Println(s.cwd)
+	return nil
+}
+
+func (s *shell) ls(args []string) error {
+	p := "."
+	if len(args) > 0 {
+		p = args[0]
+	}
+
+	paths, err := s.client.List(s.resolveDir(p))
+	if err != nil {
+		return err
+	}
+
+	for _, p := range *paths {
+		log.Println(p)
+	}
+
+	return nil
+}
+
+func (s *shell) get(args []string) error {
+	src := s.resolve(args[0])
+	dst := path.Base(strings.TrimSuffix(src, "/"))
+	if len(args) > 1 {
+		dst = args[1]
+	}
+
+	return s.client.Get(src, dst)
+}
+
+func (s *shell) put(args []string) error {
+	dst := s.cwd
+	if len(args) > 1 {
+		dst = args[1]
+	}
+
+	return s.client.Put(args[0], s.resolveDir(dst))
+}
+
+func (s *shell) rm(args []string) error {
+	return s.client.Delete(s.resolve(args[0]))
+}
+
+func (s *shell) mv(args []string) error {
+	return s.client.Move(s.resolve(args[0]), s.resolveDir(args[1]))
+}
+
+func (s *shell) mkdir(args []string) error {
+	return s.client.Mkdir(s.resolve(args[0]))
+}
+
+func (s *shell) help(args []string) error {
+	var names []string
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c := shellCommands[name]
+		fmt.Printf("  %-24s %s\n", c.usage, c.help)
+	}
+	fmt.Println("Paths are relative to the working folder unless they start with a root like mega:/")
+
+	return nil
+}
+
+func (s *shell) exit(args []string) error {
+	return io.EOF
+}
+
+// Split a command line into words, which may be quoted or have spaces
+// escaped with a backslash
+//
+// Also returns the position where the last word starts and whether the
+// line ends within it.
+func splitWords(line []rune) ([]string, int, bool) {
+	var words []string
+	var word []rune
+	var quote rune
+	var escape, inword bool
+	start := len(line)
+
+	for i, r := range line {
+		if !inword && unicode.IsSpace(r) {
+			continue
+		}
+
+		if !inword {
+			inword = true
+			start = i
+		}
+
+		switch {
+		case escape:
+			word = append(word, r)
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape = true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word = append(word, r)
+		case r == '"' || r == '\'':
+			quote = r
+		case unicode.IsSpace(r):
+			words = append(words, string(word))
+			word = nil
+			inword = false
+		default:
+			word = append(word, r)
+		}
+	}
+
+	if inword {
+		words = append(words, string(word))
+	} else {
+		start = len(line)
+	}
+
+	return words, start, inword
+}
+
+func escapeWord(w string) string {
+	var b strings.Builder
+	for _, r := range w {
+		if unicode.IsSpace(r) || strings.ContainsRune(`\"'`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// Complete the word before the cursor with the commands or the remote
+// names starting with it
+func (s *shell) complete(line []rune, pos int) ([]rune, int) {
+	words, start, inword := splitWords(line[:pos])
+	word := ""
+	if inword {
+		word = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	var dir string
+	var candidates []string
+	switch {
+	case len(words) == 0:
+		for name := range shellCommands {
+			if strings.HasPrefix(name, word) {
+				candidates = append(candidates, name+" ")
+			}
+		}
+	case shellCommands[words[0]].local == len(words):
+		// Local paths are not completed
+		return line, pos
+	default:
+		i := strings.LastIndex(word, "/")
+		dir = word[:i+1]
+		names, err := s.client.Names(s.resolve(dir))
+		if err != nil {
+			return line, pos
+		}
+		for _, name := range names {
+			if strings.HasPrefix(name, word[i+1:]) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	sort.Strings(candidates)
+
+	if len(candidates) == 0 {
+		return line, pos
+	}
+
+	completion := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, completion) {
+			r := []rune(completion)
+			completion = string(r[:len(r)-1])
+		}
+	}
+
+	if len(candidates) > 1 && dir+completion == word {
+		fmt.Println()
+		fmt.Println(strings.Join(candidates, "  "))
+		return line, pos
+	}
+
+	completed := []rune(escapeWord(dir + completion))
+	if len(candidates) == 1 && !strings.HasSuffix(completion, "/") && len(words) > 0 {
+		completed = append(completed, ' ')
+	}
+
+	rest := line[pos:]
+	line = append(append(append([]rune{}, line[:start]...), completed...), rest...)
+
+	return line, start + len(completed)
+}
+
+// Run stty on a terminal
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+
+	return strings.TrimSpace(string(out)), err
+}
+
+// Read a command line, with line editing, history and completion on a
+// terminal
+func (s *shell) readLine(prompt string) (string, error) {
+	if !s.tty {
+		line, err := s.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimSpace(line), nil
+	}
+
+	// The terminal is put in raw mode only while reading. ^C during a
+	// command quits megacmd as outside the shell, so the session of the
+	// shell ends with it.
+	state, err := stty(os.Stdin, "-g")
+	if err != nil {
+		return "", err
+	}
+	_, err = stty(os.Stdin, "-icanon", "-echo", "-isig", "min", "1")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_, _ = stty(os.Stdin, state)
+	}()
+
+	var line []rune
+	pos := 0
+	hist := len(s.history)
+
+	redraw := func() {
+		fmt.Printf("\r\033[K%s%s", prompt, string(line))
+		if n := len(line) - pos; n > 0 {
+			fmt.Printf("\033[%dD", n)
+		}
+	}
+	redraw()
+
+	for {
+		r, _, err := s.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Println()
+			if text := strings.TrimSpace(string(line)); text != "" {
+				s.history = append(s.history, text)
+				if len(s.history) > SHELL_HISTORY {
+					s.history = s.history[1:]
+				}
+			}
+			return string(line), nil
+		case 3: // ^C abandons the line
+			fmt.Println("^C")
+			line, pos, hist = nil, 0, len(s.history)
+		case 4: // ^D leaves the shell on an empty line
+			if len(line) == 0 {
+				fmt.Println()
+				return "", io.EOF
+			}
+		case 1: // ^A
+			pos = 0
+		case 5: // ^E
+			pos = len(line)
+		case 21: // ^U
+			line, pos = line[pos:], 0
+		case 127, 8:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case '\t':
+			line, pos = s.complete(line, pos)
+		case 27:
+			line, pos, hist = s.escapeSequence(line, pos, hist)
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+
+		redraw()
+	}
+}
+
+// Handle the arrow and delete keys
+func (s *shell) escapeSequence(line []rune, pos, hist int) ([]rune, int, int) {
+	if r, _, err := s.in.ReadRune(); err != nil || r != '[' {
+		return line, pos, hist
+	}
+
+	r, _, err := s.in.ReadRune()
+	if err != nil {
+		return line, pos, hist
+	}
+
+	switch r {
+	case 'A', 'B':
+		if r == 'A' && hist > 0 {
+			hist--
+		}
+		if r == 'B' && hist < len(s.history) {
+			hist++
+		}
+		line = nil
+		if hist < len(s.history) {
+			line = []rune(s.history[hist])
+		}
+		pos = len(line)
+	case 'C':
+		if pos < len(line) {
+			pos++
+		}
+	case 'D':
+		if pos > 0 {
+			pos--
+		}
+	case '3':
+		if r, _, err := s.in.ReadRune(); err == nil && r == '~' && pos < len(line) {
+			line = append(line[:pos], line[pos+1:]...)
+		}
+	}
+
+	return line, pos, hist
+}
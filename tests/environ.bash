@@ -51,3 +51,19 @@ function fail() {
     cat $OUT
     exit 1
 }
+
+function run_code() {
+    code=$1
+    shift
+    echo
+    echo Executing run expecting exit code $code $@
+    $@ &> $OUT
+
+    status=$?
+    if [ $status -ne $code ];
+    then
+        echo ${BASH_SOURCE[1]}:${BASH_LINENO[0]} FAIL: Executing failed - expects exit code $code, got $status
+        cat $OUT
+        exit 1
+    fi
+}
@@ -1,5 +1,7 @@
 #!/bin/bash
 
 CONFIG="test_config.json"
-sed "s/MEGA_PASSWD/$MEGA_PASSWD/;s/MEGA_USER/$MEGA_USER/" $CONFIG > t.json
+# The second account is optional, it is used by the tests between two
+# accounts
+sed "s/MEGA_PASSWD2/$MEGA_PASSWD2/;s/MEGA_USER2/$MEGA_USER2/;s/MEGA_PASSWD/$MEGA_PASSWD/;s/MEGA_USER/$MEGA_USER/" $CONFIG > t.json
 
@@ -0,0 +1,47 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+run $MEGACMD whoami
+if ! grep -q "^Email  : " $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD df
+if ! grep -q "^Total : " $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD -json df
+if ! grep -q '^{"used":[0-9]*,"free":[0-9]*,"total":[0-9]*}$' $OUT;
+then
+    fail Unexpected result
+fi
+
+mkdir -p $JUNK/du/a/b
+silent dd if=/dev/urandom of=$JUNK/du/d.1 bs=1k count=10
+silent dd if=/dev/urandom of=$JUNK/du/a/d.2 bs=1k count=20
+silent dd if=/dev/urandom of=$JUNK/du/a/b/d.3 bs=1k count=30
+run $MEGACMD sync $JUNK/du mega:/testing/du
+run $MEGACMD du mega:/testing/du
+expected="61440      3          mega:/testing/du"
+if ! grep -q "^$expected\$" $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD -depth 1 -sort size du mega:/testing/du
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 2 ];
+then
+    fail Count mismatch $count
+fi
+if ! head -1 $OUT | grep -q "mega:/testing/du$";
+then
+    fail Unexpected result
+fi
+
+run_fail $MEGACMD -sort name du mega:/testing/du
+run $MEGACMD -check-usage du mega:/testing/du
@@ -0,0 +1,103 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+
+mkdir -p $JUNK/bisync/dira
+silent dd if=/dev/urandom of=$JUNK/bisync/dira/x.1 bs=1k count=1
+silent dd if=/dev/urandom of=$JUNK/bisync/x.2 bs=1k count=1
+
+run_fail $MEGACMD bisync $JUNK/nothing mega:/testing/bisync
+
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+run $MEGACMD -recursive list mega:/testing/bisync/
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 3 ];
+then
+    fail Count mismatch $count
+fi
+
+silent dd if=/dev/urandom of=$JUNK/x.3 bs=1k count=1
+run $MEGACMD put $JUNK/x.3 mega:/testing/bisync/
+rm $JUNK/bisync/x.2
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+
+if [ ! -e $JUNK/bisync/x.3 ];
+then
+    fail "Remote file not downloaded"
+fi
+
+run $MEGACMD list mega:/testing/bisync/
+if grep -q "x.2" $OUT;
+then
+    fail "Locally deleted file should be deleted remotely"
+fi
+
+silent dd if=/dev/urandom of=$JUNK/bisync/x.3 bs=1k count=2
+run $MEGACMD delete mega:/testing/bisync/x.3
+silent dd if=/dev/urandom of=$JUNK/x.3 bs=1k count=3
+run $MEGACMD put $JUNK/x.3 mega:/testing/bisync/
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+
+count=`ls $JUNK/bisync | grep -c "x.3.conflict-"`
+if [ $count -ne 1 ];
+then
+    fail "Conflict copy not found"
+fi
+
+# Files of the same size created on both sides are compared by contents
+silent dd if=/dev/urandom of=$JUNK/bisync/y.1 bs=1k count=1
+silent dd if=/dev/urandom of=$JUNK/y.1 bs=1k count=1
+run $MEGACMD put $JUNK/y.1 mega:/testing/bisync/
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+
+count=`ls $JUNK/bisync | grep -c "y.1.conflict-"`
+if [ $count -ne 1 ];
+then
+    fail "Conflict copy of same size file not found"
+fi
+
+# Folders deleted on one side are deleted on the other
+rm -r $JUNK/bisync/dira
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+run $MEGACMD list mega:/testing/bisync/
+if grep -q "dira" $OUT;
+then
+    fail "Locally deleted folder should be deleted remotely"
+fi
+
+mkdir -p $JUNK/bisync/dirb/dirc
+silent dd if=/dev/urandom of=$JUNK/bisync/dirb/dirc/z.1 bs=1k count=1
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+run $MEGACMD delete mega:/testing/bisync/dirb
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+if [ -e $JUNK/bisync/dirb ];
+then
+    fail "Remotely deleted folder should be deleted locally"
+fi
+
+# A folder deleted on one side is kept when a new file was added to it
+# on the other side
+mkdir -p $JUNK/bisync/dird
+silent dd if=/dev/urandom of=$JUNK/bisync/dird/w.1 bs=1k count=1
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+run $MEGACMD delete mega:/testing/bisync/dird
+silent dd if=/dev/urandom of=$JUNK/bisync/dird/w.2 bs=1k count=1
+
+run $MEGACMD -dry-run bisync $JUNK/bisync mega:/testing/bisync
+if grep -q "delete *$JUNK/bisync/dird$" $OUT;
+then
+    fail "Folder with a new file planned for deletion"
+fi
+
+run $MEGACMD bisync $JUNK/bisync mega:/testing/bisync
+if [ ! -e $JUNK/bisync/dird/w.2 ] || [ -e $JUNK/bisync/dird/w.1 ];
+then
+    fail "Folder with a new file not kept"
+fi
+
+run $MEGACMD list mega:/testing/bisync/dird/
+if ! grep -q "w.2" $OUT;
+then
+    fail "New file in remotely deleted folder not uploaded"
+fi
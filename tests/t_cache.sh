@@ -0,0 +1,37 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+run $MEGACMD -cache list mega:/testing/
+count=`find $JUNK/state/cache -type f -perm 600 | wc -l | awk '{ print $1 }'`
+if [ $count -ne 1 ];
+then
+    fail "Filesystem not cached"
+fi
+
+# Changes made without the cache are fetched as events
+run $MEGACMD mkdir mega:/testing/cached
+run $MEGACMD -cache list mega:/testing/
+if ! grep -q "mega:/testing/cached/" $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD delete mega:/testing/cached
+run $MEGACMD -cache list mega:/testing/
+if grep -q "mega:/testing/cached/" $OUT;
+then
+    fail Unexpected result
+fi
+
+# A broken cache is replaced by fetching the whole filesystem
+for f in `find $JUNK/state/cache -type f`
+do
+    echo junk > $f
+done
+run $MEGACMD -cache mkdir mega:/testing/cached2
+run $MEGACMD -cache list mega:/testing/
+if ! grep -q "mega:/testing/cached2/" $OUT;
+then
+    fail Unexpected result
+fi
@@ -0,0 +1,68 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+
+mkdir -p $JUNK/copy/dira/dirb
+silent dd if=/dev/urandom of=$JUNK/copy/x.1 bs=1k count=1
+silent dd if=/dev/urandom of=$JUNK/copy/dira/dirb/x.2 bs=1k count=1
+
+run $MEGACMD -recursive put $JUNK/copy mega:/testing/copy
+run $MEGACMD mkdir mega:/testing/dest
+
+run $MEGACMD copy mega:/testing/copy/x.1 mega:/testing/x.1
+run $MEGACMD get mega:/testing/x.1 $JUNK/x.1
+cmp -s $JUNK/x.1 $JUNK/copy/x.1 || fail Copied file differs
+
+run $MEGACMD copy mega:/testing/copy mega:/testing/dest/
+run $MEGACMD -recursive list mega:/testing/dest/
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 5 ];
+then
+    fail Count mismatch $count
+fi
+
+run $MEGACMD get mega:/testing/dest/copy/dira/dirb/x.2 $JUNK/x.2
+cmp -s $JUNK/x.2 $JUNK/copy/dira/dirb/x.2 || fail Copied file differs
+
+# The original is left in place
+run $MEGACMD list mega:/testing/copy/dira/dirb/
+grep -q x.2 $OUT || fail Source was removed
+
+run $MEGACMD -dry-run copy mega:/testing/copy mega:/testing/renamed
+run $MEGACMD list mega:/testing/
+grep -q renamed $OUT && fail Dry run copied the folder
+
+run_code 5 $MEGACMD copy mega:/testing/copy mega:/testing/dest/
+run_code 5 $MEGACMD copy mega:/testing/copy/x.1 mega:/testing/x.1
+run_code 3 $MEGACMD copy mega:/testing/copy mega:/testing/copy/dira/
+run_code 4 $MEGACMD copy mega:/testing/nothing mega:/testing/dest/
+
+# The folder is doubled until the copy takes more than the free storage
+silent dd if=/dev/urandom of=$JUNK/big bs=1M count=64
+run $MEGACMD mkdir mega:/testing/quota/a
+run $MEGACMD put $JUNK/big mega:/testing/quota/a/
+code=0
+for i in `seq 16`
+do
+    $MEGACMD copy mega:/testing/quota/a mega:/testing/quota/b &> $OUT
+    code=$?
+    if [ $code -ne 0 ];
+    then
+        break
+    fi
+    run $MEGACMD move mega:/testing/quota/b mega:/testing/quota/a/b$i
+done
+
+run $MEGACMD list mega:/testing/quota/
+if grep -q "mega:/testing/quota/b " $OUT;
+then
+    fail "Copy started without enough storage quota"
+fi
+
+# Files in trash count against the quota too
+run $MEGACMD -force delete mega:/testing/quota
+if [ $code -ne 7 ];
+then
+    fail "Expected exit code 7 for copy over quota, got $code"
+fi
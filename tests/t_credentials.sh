@@ -0,0 +1,18 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+MEGACMD_BIN="../$MEGACMD_NAME -verbose=0"
+
+echo '{ "StateDir" : "junk/state" }' > $JUNK/nocred.json
+run env MEGA_USER=$MEGA_USER MEGA_PASSWD=$MEGA_PASSWD $MEGACMD_BIN -conf=$JUNK/nocred.json list mega:/testing/
+
+# The config file is optional when the user is in the environment
+run env MEGA_USER=$MEGA_USER MEGA_PASSWD=$MEGA_PASSWD $MEGACMD_BIN -conf=$JUNK/missing.json list mega:/testing/
+
+echo "$MEGA_PASSWD" > $JUNK/passwd
+echo '{ "StateDir" : "junk/state", "PasswordCommand" : "cat junk/passwd" }' > $JUNK/passcmd.json
+run env -u MEGA_PASSWD MEGA_USER=$MEGA_USER $MEGACMD_BIN -conf=$JUNK/passcmd.json list mega:/testing/
+
+echo '{ "StateDir" : "junk/state", "PasswordCommand" : "false" }' > $JUNK/badcmd.json
+run_code 6 env -u MEGA_PASSWD MEGA_USER=$MEGA_USER $MEGACMD_BIN -conf=$JUNK/badcmd.json list mega:/testing/
@@ -0,0 +1,61 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+
+mkdir -p $JUNK/sync1/dira
+silent dd if=/dev/urandom of=$JUNK/sync1/dira/x.1 bs=1k count=1
+silent dd if=/dev/urandom of=$JUNK/x.2 bs=1k count=1
+
+run $MEGACMD -dry-run put $JUNK/x.2 mega:/testing/
+if ! grep -q "upload" $OUT;
+then
+    fail "Planned upload not shown"
+fi
+
+run $MEGACMD -dry-run mkdir mega:/testing/dir1
+run $MEGACMD -dry-run sync $JUNK/sync1 mega:/testing/sync1
+run $MEGACMD -recursive list mega:/testing/
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 0 ];
+then
+    fail Count mismatch $count
+fi
+
+run $MEGACMD put $JUNK/x.2 mega:/testing/
+run $MEGACMD -dry-run delete mega:/testing/x.2
+run $MEGACMD -dry-run move mega:/testing/x.2 mega:/testing/x.3
+run $MEGACMD -dry-run -force get mega:/testing/x.2 $JUNK/
+run $MEGACMD list mega:/testing/
+if ! grep -q "x.2" $OUT;
+then
+    fail "File changed in dry run mode"
+fi
+
+# New nested folders are planned from the top, each file after its folder
+mkdir -p $JUNK/sync2/dira/dirb
+silent dd if=/dev/urandom of=$JUNK/sync2/dira/dirb/x.1 bs=1k count=1
+silent dd if=/dev/urandom of=$JUNK/sync2/x.2 bs=1k count=1
+
+run $MEGACMD -dry-run sync $JUNK/sync2 mega:/testing/sync2
+cat > $JUNK/plan.txt <<PLAN
+DRY-RUN: create dir mega:/testing/sync2
+DRY-RUN: create dir mega:/testing/sync2/dira
+DRY-RUN: create dir mega:/testing/sync2/dira/dirb
+DRY-RUN: upload     $JUNK/sync2/dira/dirb/x.1 -> mega:/testing/sync2/dira/dirb/x.1
+DRY-RUN: upload     $JUNK/sync2/x.2 -> mega:/testing/sync2/x.2
+PLAN
+diff $JUNK/plan.txt $OUT || fail "Sync plan mismatch"
+
+run $MEGACMD sync $JUNK/sync2 mega:/testing/sync2
+run $MEGACMD -dry-run sync mega:/testing/sync2/dira $JUNK/sync3
+cat > $JUNK/plan.txt <<PLAN
+DRY-RUN: create dir $JUNK/sync3
+DRY-RUN: create dir $JUNK/sync3/dirb
+DRY-RUN: download   mega:/testing/sync2/dira/dirb/x.1 -> $JUNK/sync3/dirb/x.1
+PLAN
+diff $JUNK/plan.txt $OUT || fail "Sync plan mismatch"
+if [ -e $JUNK/sync3 ];
+then
+    fail "Directory created in dry run mode"
+fi
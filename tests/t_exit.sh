@@ -0,0 +1,18 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+silent dd if=/dev/urandom of=$JUNK/e.1 bs=1k count=10
+
+run_code 2 $MEGACMD list
+run_code 2 $MEGACMD -output xml list mega:/testing/
+run_code 2 $MEGACMD -compare=nothing put $JUNK/e.1 mega:/testing/
+run_code 2 $MEGACMD frobnicate mega:/testing/
+run_code 3 $MEGACMD list foo:/testing/
+run_code 4 $MEGACMD get mega:/testing/non-existent $JUNK/tmp/
+run_code 3 $MEGACMD put $JUNK/non-existent mega:/testing/
+run $MEGACMD put $JUNK/e.1 mega:/testing/
+run_code 5 $MEGACMD put $JUNK/e.1 mega:/testing/
+
+echo '{"User":"nobody@example.com","Password":"wrong"}' > $JUNK/bad.json
+run_code 6 ../$MEGACMD_NAME -conf=$JUNK/bad.json -verbose=0 list mega:/testing/
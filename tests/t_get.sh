@@ -34,3 +34,40 @@ run_fail $MEGACMD get mega:/testing/x.1 $JUNK/tmp
 run $MEGACMD -force get mega:/testing/x.1 $JUNK/tmp/
 
 run $MEGACMD -force get mega:/testing/x.1
+
+touch -t 201501010000 $JUNK/x.2
+run $MEGACMD -force put $JUNK/x.2 mega:/testing/x.5
+run $MEGACMD get mega:/testing/x.5 $JUNK/tmp/
+if [ `date -r $JUNK/x.2 +%s` -ne `date -r $JUNK/tmp/x.5 +%s` ];
+then
+    fail "Modification time not preserved"
+fi
+
+echo "junk" > $JUNK/tmp/x.4r.partial
+echo '{"Hash":"junk","Size":5,"Chunks":[0]}' > $JUNK/tmp/x.4r.partial.json
+run $MEGACMD -resume get mega:/testing/x.4 $JUNK/tmp/x.4r
+if [ -e $JUNK/tmp/x.4r.partial ] || [ -e $JUNK/tmp/x.4r.partial.json ];
+then
+    fail "Partial download not cleaned up"
+fi
+
+count=`shasum $JUNK/x.4 $JUNK/tmp/x.4r | cut -d' ' -f1 | sort -u | wc -l | awk '{ print $1 }'`
+if [ $count -ne 1 ];
+then
+    fail "Sha1sum mismatch"
+fi
+
+mkdir -p $JUNK/tree/a/b
+silent dd if=/dev/urandom of=$JUNK/tree/t.1 bs=1k count=10
+silent dd if=/dev/urandom of=$JUNK/tree/a/b/t.2 bs=1k count=20
+run $MEGACMD -recursive put $JUNK/tree mega:/testing/
+run_fail $MEGACMD get mega:/testing/tree $JUNK/tmp/
+run $MEGACMD -recursive get mega:/testing/tree $JUNK/tmp/
+run $MEGACMD -recursive get mega:/testing/tree $JUNK/tmp/tree2
+for d in tree tree2
+do
+    if ! diff -r $JUNK/tree $JUNK/tmp/$d > /dev/null;
+    then
+        fail "Recursive get mismatch in $d"
+    fi
+done
@@ -0,0 +1,83 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+mkdir -p $JUNK/links/sub
+silent dd if=/dev/urandom of=$JUNK/links/l.1 bs=1k count=10
+silent dd if=/dev/urandom of=$JUNK/links/sub/l.2 bs=1k count=10
+run $MEGACMD sync $JUNK/links mega:/testing/links
+
+run $MEGACMD link mega:/testing/links/l.1
+if ! grep -q '^https://mega.co.nz/#!.*!.*$' $OUT;
+then
+    fail "Link with key not found"
+fi
+
+run $MEGACMD -no-key link mega:/testing/links/l.1
+if grep -q '^https://mega.co.nz/#!.*!' $OUT;
+then
+    fail "Link includes the key"
+fi
+
+run $MEGACMD -print-key link mega:/testing/links/l.1
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 2 ];
+then
+    fail Count mismatch $count
+fi
+
+run_fail $MEGACMD link mega:/testing/links
+run_fail $MEGACMD link mega:/testing/nolink
+
+run $MEGACMD -recursive link mega:/testing/links
+count=`grep -c "^mega:/testing/links/.*	https://" $OUT`
+if [ $count -ne 2 ];
+then
+    fail Count mismatch $count
+fi
+
+run $MEGACMD link mega:/testing/links/l.1
+link=`cat $OUT`
+run ../$MEGACMD_NAME -conf=$JUNK/missing.json -verbose=0 get "$link" $JUNK/tmp/
+count=`shasum $JUNK/links/l.1 $JUNK/tmp/l.1 | cut -d' ' -f1 | sort -u | wc -l | awk '{ print $1 }'`
+if [ $count -ne 1 ];
+then
+    fail "Sha1sum mismatch"
+fi
+
+run_fail $MEGACMD get "${link%!*}" $JUNK/tmp/l.2
+run_fail $MEGACMD get "${link%!*}!AAAA" $JUNK/tmp/l.2
+
+run $MEGACMD mkdir mega:/testing/incoming
+run $MEGACMD import "$link" mega:/testing/incoming/
+run $MEGACMD import "$link" mega:/testing/incoming/renamed.1
+run_fail $MEGACMD import "$link" mega:/testing/incoming/renamed.1/
+run_fail $MEGACMD import "$link" mega:/testing/nodir/x
+run_fail $MEGACMD import mega:/testing/links/l.1 mega:/testing/incoming/
+run $MEGACMD list mega:/testing/incoming/
+for f in l.1 renamed.1
+do
+    if ! grep -q "mega:/testing/incoming/$f " $OUT;
+    then
+        fail "Imported file $f not found"
+    fi
+done
+
+run_code 5 $MEGACMD import "$link" mega:/testing/incoming/
+run_code 5 $MEGACMD import "$link" mega:/testing/incoming/renamed.1
+run $MEGACMD -force import "$link" mega:/testing/incoming/
+run $MEGACMD list mega:/testing/incoming/
+count=`grep -c "mega:/testing/incoming/l.1 " $OUT`
+if [ $count -ne 1 ];
+then
+    fail "Import created a duplicate of l.1"
+fi
+
+# The name of a public file comes from whoever shared it, so it must not
+# lead out of the destination directory
+silent dd if=/dev/urandom of='junk/evil\name' bs=1k count=1
+run $MEGACMD put 'junk/evil\name' mega:/testing/links/
+run $MEGACMD link 'mega:/testing/links/evil\name'
+link=`cat $OUT`
+run_code 3 ../$MEGACMD_NAME -conf=$JUNK/missing.json -verbose=0 get "$link" $JUNK/tmp/
+ls $JUNK/tmp | grep -q evil && fail "File with unsafe name was saved"
@@ -49,3 +49,11 @@ if [[ ! `cat $OUT` =~ "$expected" ]];
 then
     fail Unexpected result
 fi
+
+run $MEGACMD list shared:/
+run $MEGACMD list inbox:/
+run $MEGACMD list shared:/nobody@example.com/nofolder/
+if [ -s $OUT ];
+then
+    fail Unexpected result
+fi
@@ -0,0 +1,54 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+silent dd if=/dev/urandom of=$JUNK/o.1 bs=1k count=10
+
+run $MEGACMD -output jsonl put $JUNK/o.1 mega:/testing/
+if ! grep -q '"command":"put",.*"status":"ok"' $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD -output csv list mega:/testing/
+if ! head -1 $OUT | grep -q "^path,type,size,mtime,hash,link$";
+then
+    fail Unexpected result
+fi
+if ! grep -q "^mega:/testing/o.1,file,10240," $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD -output tsv list mega:/testing/
+if ! grep -q "^mega:/testing/o.1	file	10240	" $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD -output json list mega:/testing/
+if ! grep -q '"path": "mega:/testing/o.1"' $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD link mega:/testing/o.1
+run $MEGACMD -output jsonl list mega:/testing/
+if ! grep -q '"link":"https://mega' $OUT;
+then
+    fail Unexpected result
+fi
+
+run $MEGACMD -dry-run -output jsonl delete mega:/testing/o.1
+if ! grep -q '"status":"dry-run"' $OUT;
+then
+    fail Unexpected result
+fi
+
+run_fail $MEGACMD -output jsonl put $JUNK/o.1 mega:/testing/
+if ! grep -q '"status":"error"' $OUT;
+then
+    fail Unexpected result
+fi
+
+run_fail $MEGACMD -output xml list mega:/testing/
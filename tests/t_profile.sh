@@ -0,0 +1,57 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+
+mkdir -p $JUNK/profile/dira/dirb
+silent dd if=/dev/urandom of=$JUNK/profile/x.1 bs=1k count=1
+silent dd if=/dev/urandom of=$JUNK/profile/dira/dirb/x.2 bs=1k count=1
+
+run $MEGACMD -profile backup -recursive put $JUNK/profile mega:/testing/profile
+run_code 2 $MEGACMD -profile nothing list mega:/testing/
+run_code 2 $MEGACMD list nothing@mega:/testing/
+
+run $MEGACMD list backup@mega:/testing/profile/
+grep -q x.1 $OUT || fail Profile path not listed
+
+# Both profiles log in to the test account, so this copies between
+# two folders of it
+run $MEGACMD -dry-run sync mega:/testing/profile backup@mega:/testing/copy
+run $MEGACMD list mega:/testing/
+grep -q copy $OUT && fail Dry run created the destination
+
+run $MEGACMD sync mega:/testing/profile backup@mega:/testing/copy
+run $MEGACMD -recursive list mega:/testing/copy/
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 4 ];
+then
+    fail Count mismatch $count
+fi
+
+run_fail $MEGACMD sync mega:/testing/profile backup@mega:/testing/copy
+run $MEGACMD -compare size sync mega:/testing/profile backup@mega:/testing/copy
+
+run $MEGACMD get backup@mega:/testing/copy/dira/dirb/x.2 $JUNK/x.2
+cmp -s $JUNK/x.2 $JUNK/profile/dira/dirb/x.2 || fail Copied file differs
+
+run_code 3 $MEGACMD move mega:/testing/profile/x.1 backup@mega:/testing/x.1
+
+# A profile with its own credentials doesn't inherit the password of the
+# top level account
+cat > $JUNK/profiles.json <<CONF
+{
+    "User" : "$MEGA_USER",
+    "Password" : "$MEGA_PASSWD",
+    "StateDir" : "junk/state",
+    "Profiles" : {
+        "cmd" : {
+            "User" : "$MEGA_USER",
+            "PasswordCommand" : "false"
+        }
+    }
+}
+CONF
+MEGACMD_BIN="../$MEGACMD_NAME -verbose=0 -conf=$JUNK/profiles.json"
+run $MEGACMD_BIN list mega:/testing/
+run_code 6 env -u MEGA_PASSWD $MEGACMD_BIN -profile cmd list mega:/testing/
+run_code 6 env -u MEGA_PASSWD $MEGACMD_BIN sync mega:/testing/profile cmd@mega:/testing/copy2
@@ -40,3 +40,38 @@ run_fail $MEGACMD put $JUNK/x.1 mega:/testing/newdir
 run $MEGACMD put $JUNK/x.1 mega:/testing/newdir/
 run_fail $MEGACMD put $JUNK/x.1 mega:/testing/newdir/x.1
 
+silent dd if=/dev/urandom of=$JUNK/x.3 bs=1k count=50
+run $MEGACMD -compare=size put $JUNK/x.3 mega:/testing/newdir/x.1
+run_fail $MEGACMD -compare=checksum put $JUNK/x.3 mega:/testing/newdir/x.1
+run $MEGACMD -compare=checksum put $JUNK/x.1 mega:/testing/newdir/x.1
+run_fail $MEGACMD -compare=checksum put $JUNK/x.2 mega:/testing/newdir/x.1
+run_fail $MEGACMD -compare=nothing put $JUNK/x.1 mega:/testing/newdir/x.1
+
+run $MEGACMD -resume put $JUNK/x.2 mega:/testing/resumed.2
+expected="mega:/testing/resumed.2                            102400"
+run $MEGACMD list mega:/testing/
+if ! grep -q "$expected" $OUT;
+then
+    fail Unexpected result
+fi
+
+count=`find $JUNK/state/uploads -type f 2>/dev/null | wc -l | awk '{ print $1 }'`
+if [ $count -ne 0 ];
+then
+    fail "Upload journal not cleaned up"
+fi
+
+mkdir -p $JUNK/tree/a/b
+silent dd if=/dev/urandom of=$JUNK/tree/t.1 bs=1k count=10
+silent dd if=/dev/urandom of=$JUNK/tree/a/b/t.2 bs=1k count=20
+run_fail $MEGACMD put $JUNK/tree mega:/testing/
+run $MEGACMD -recursive put $JUNK/tree mega:/testing/
+run $MEGACMD -recursive put $JUNK/tree mega:/testing/tree2
+run $MEGACMD -recursive list mega:/testing/
+for f in tree/t.1 tree/a/b/t.2 tree2/t.1 tree2/a/b/t.2
+do
+    if ! grep -q "mega:/testing/$f " $OUT;
+    then
+        fail "Recursive put missed $f"
+    fi
+done
@@ -0,0 +1,40 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+run $MEGACMD login
+count=`find $JUNK/state/sessions -type f 2>/dev/null | wc -l | awk '{ print $1 }'`
+if [ $count -ne 1 ];
+then
+    fail "Session not cached"
+fi
+
+count=`find $JUNK/state/sessions -type f -perm 600 | wc -l | awk '{ print $1 }'`
+if [ $count -ne 1 ];
+then
+    fail "Session readable by others"
+fi
+
+run $MEGACMD mkdir mega:/testing/session
+run $MEGACMD list mega:/testing/
+if ! grep -q "mega:/testing/session/" $OUT;
+then
+    fail Unexpected result
+fi
+
+# A corrupt session is replaced by logging in with the password
+for f in `find $JUNK/state/sessions -type f`
+do
+    echo junk > $f
+done
+run $MEGACMD list mega:/testing/
+
+run $MEGACMD logout
+count=`find $JUNK/state/sessions -type f 2>/dev/null | wc -l | awk '{ print $1 }'`
+if [ $count -ne 0 ];
+then
+    fail "Session not removed"
+fi
+
+run $MEGACMD logout
+run $MEGACMD list mega:/testing/
@@ -0,0 +1,44 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+run $MEGACMD mkdir mega:/testing/shared
+run_fail $MEGACMD -access admin share mega:/testing/shared nobody@example.com
+run_fail $MEGACMD share mega:/testing/shared nobody
+run_fail $MEGACMD share mega:/testing/noshared nobody@example.com
+run $MEGACMD -dry-run share mega:/testing/shared nobody@example.com
+run $MEGACMD shares
+if grep -q "mega:/testing/shared/" $OUT;
+then
+    fail "Dry run created a share"
+fi
+
+# Round trip with a second account, which must be a contact of the first
+# one. Set MEGA_USER2 and MEGA_PASSWD2 to run it.
+if [ -n "$MEGA_USER2" ];
+then
+    SECOND="env -u MEGA_USER -u MEGA_PASSWD $MEGACMD -profile second"
+    silent dd if=/dev/urandom of=$JUNK/sh.1 bs=1k count=1
+    run $MEGACMD put $JUNK/sh.1 mega:/testing/shared/
+    run $MEGACMD share mega:/testing/shared $MEGA_USER2
+    run $MEGACMD shares
+    if ! grep -q "^mega:/testing/shared/ .*$MEGA_USER2 read$" $OUT;
+    then
+        fail "Share not listed"
+    fi
+
+    # The second account can decrypt the files only with a valid share key
+    run $SECOND get shared:/$MEGA_USER/shared/sh.1 $JUNK/tmp/sh.1
+    if ! cmp -s $JUNK/sh.1 $JUNK/tmp/sh.1;
+    then
+        fail "Shared file differs"
+    fi
+
+    run $MEGACMD unshare mega:/testing/shared $MEGA_USER2
+    run $MEGACMD shares
+    if grep -q "mega:/testing/shared/" $OUT;
+    then
+        fail "Share not removed"
+    fi
+    run_fail $SECOND list shared:/$MEGA_USER/shared/
+fi
@@ -0,0 +1,50 @@
+#!/bin/bash
+. environ.bash
+
+init_env
+silent dd if=/dev/urandom of=$JUNK/s.1 bs=1k count=10
+
+cat > $JUNK/cmds <<CMDS
+mkdir dir
+cd dir
+pwd
+put $JUNK/s.1
+mkdir "sub dir"
+mv s.1 sub\ dir
+cd ..
+ls dir/sub\ dir
+get dir/sub\ dir/s.1 $JUNK/tmp/
+CMDS
+
+run $MEGACMD shell mega:/testing < $JUNK/cmds
+if ! grep -q "^mega:/testing/dir$" $OUT;
+then
+    fail Unexpected result
+fi
+if ! grep -q "^mega:/testing/dir/sub dir/s.1 .* 10240 " $OUT;
+then
+    fail Unexpected result
+fi
+if ! cmp -s $JUNK/s.1 $JUNK/tmp/s.1;
+then
+    fail Downloaded file differs
+fi
+
+echo "frobnicate" | $MEGACMD shell &> $OUT
+if [ $? -eq 0 ];
+then
+    fail "Failed command should fail the shell"
+fi
+if ! grep -q "ERROR: Unknown command" $OUT;
+then
+    fail Unexpected result
+fi
+
+printf "cd non-existent\npwd\n" > $JUNK/cmds
+run_code 4 $MEGACMD shell mega:/testing < $JUNK/cmds
+if ! grep -q "^mega:/testing$" $OUT;
+then
+    fail "Shell stopped after a failed command"
+fi
+
+run_fail $MEGACMD shell mega:/testing/non-existent
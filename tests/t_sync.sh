@@ -42,6 +42,80 @@ fi
 run_fail $MEGACMD sync mega:/testing/syncn $JUNK/sync2
 run $MEGACMD sync mega:/testing/sync1 $JUNK/newone
 
+rm -rf $JUNK/sync1/dirb
+run $MEGACMD -delete sync $JUNK/sync1 mega:/testing/sync1
+run $MEGACMD -recursive list mega:/testing/sync1/
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 6 ];
+then
+    fail Count mismatch $count
+fi
+
+run $MEGACMD -delete sync mega:/testing/sync1 $JUNK/sync2
+count=`find $JUNK/sync2 | wc -l | awk '{ print $1 }'`
+if [ $count -ne 7 ];
+then
+    fail Count mismatch $count
+fi
+
+rm -rf $JUNK/par
+mkdir -p $JUNK/par/a $JUNK/par/b/c
+for i in {1..6}
+do
+    silent dd if=/dev/urandom of=$JUNK/par/a/p.$i bs=1k count=$i
+    silent dd if=/dev/urandom of=$JUNK/par/b/c/p.$i bs=1k count=$i
+done
+run $MEGACMD -transfers 4 sync $JUNK/par mega:/testing/par
+run $MEGACMD -transfers 4 sync mega:/testing/par $JUNK/par2
+if ! diff -r $JUNK/par $JUNK/par2 > /dev/null;
+then
+    fail "Parallel sync mismatch"
+fi
 
+rm -rf $JUNK/filt $JUNK/filt2
+mkdir -p $JUNK/filt/node_modules/x $JUNK/filt/src
+echo a > $JUNK/filt/src/a.c
+echo b > $JUNK/filt/src/b.tmp
+echo k > $JUNK/filt/src/keep.tmp
+echo c > $JUNK/filt/node_modules/x/c.js
+echo '*.tmp' > $JUNK/excludes
+run $MEGACMD -exclude node_modules/ -exclude-from $JUNK/excludes -include keep.tmp sync $JUNK/filt mega:/testing/filt
+run $MEGACMD -recursive list mega:/testing/filt/
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 3 ];
+then
+    fail Count mismatch $count
+fi
 
+run $MEGACMD -recursive -exclude '*.c' list mega:/testing/filt/
+count=`wc -l $OUT | awk '{ print $1 }'`
+if [ $count -ne 2 ];
+then
+    fail Count mismatch $count
+fi
+
+mkdir -p $JUNK/filt2
+echo d > $JUNK/filt2/local.tmp
+run $MEGACMD -delete -exclude '*.tmp' sync mega:/testing/filt $JUNK/filt2
+if [ ! -e $JUNK/filt2/local.tmp ] || [ ! -e $JUNK/filt2/src/a.c ] || [ -e $JUNK/filt2/src/keep.tmp ];
+then
+    fail "Excluded files not protected"
+fi
 
+# Destination files under an unreadable source folder are never deleted
+rm -rf $JUNK/mirror
+mkdir -p $JUNK/mirror/locked
+echo l > $JUNK/mirror/locked/l.txt
+echo m > $JUNK/mirror/m.txt
+run $MEGACMD sync $JUNK/mirror mega:/testing/mirror
+chmod 000 $JUNK/mirror/locked
+if [ ! -r $JUNK/mirror/locked ];
+then
+    run $MEGACMD -skip-error -delete sync $JUNK/mirror mega:/testing/mirror
+    run $MEGACMD list mega:/testing/mirror/locked/
+    if ! grep -q "l.txt" $OUT;
+    then
+        fail "File under unreadable source folder deleted"
+    fi
+fi
+chmod 755 $JUNK/mirror/locked